@@ -0,0 +1,98 @@
+// audit is recording remote commands executed by myutils into data store.
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/types"
+	"time"
+)
+
+// Filter selects audit records. Zero values match all records.
+type Filter struct {
+	Host  string
+	Since time.Time
+	Until time.Time
+	// Limit is a max number of latest records to return if positive
+	Limit int
+}
+
+// AddAudit save a given audit record with an id ordered by time.
+func AddAudit(db db.Store, a *types.Audit) error {
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	a.ID = fmt.Sprintf("%020d", a.Time.UnixNano())
+	encoded, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return db.Put(getAuditKey(a.ID), encoded)
+}
+
+// GetAudit returns an audit record given id
+func GetAudit(db db.Reader, id string) (*types.Audit, error) {
+	val, err := db.Get(getAuditKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find an audit record %s. %v", id, err)
+	}
+	var a *types.Audit
+	if err := json.Unmarshal(val, &a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// GetAudits returns audit records matched by a filter in order of time.
+func GetAudits(db db.Reader, filter *Filter) ([]*types.Audit, error) {
+	if filter == nil {
+		filter = &Filter{}
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && filter.Until.Before(filter.Since) {
+		return nil, errors.New("until must be after since")
+	}
+	itr := db.NewIteratorWithPrefix([]byte(types.AuditPrefix))
+	defer itr.Release()
+
+	var audits []*types.Audit
+	for itr.Next() {
+		var a *types.Audit
+		if err := json.Unmarshal(itr.Value(), &a); err != nil {
+			fmt.Println("Failed to unmarshal audit.", err)
+			continue
+		}
+		if filter.matches(a) {
+			audits = append(audits, a)
+		}
+	}
+	if filter.Limit > 0 && len(audits) > filter.Limit {
+		audits = audits[len(audits)-filter.Limit:]
+	}
+	return audits, itr.Error()
+}
+
+// matches returns true if a given record is selected by the filter.
+func (f *Filter) matches(a *types.Audit) bool {
+	if !f.Since.IsZero() && a.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && a.Time.After(f.Until) {
+		return false
+	}
+	if f.Host == "" {
+		return true
+	}
+	for _, r := range a.Hosts {
+		if r.Host == f.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// getAuditKey returns a key given id with prefix("audit.")
+func getAuditKey(id string) []byte {
+	return []byte(types.AuditPrefix + id)
+}
@@ -0,0 +1,235 @@
+// cast is read and write terminal sessions as asciicast v2 format.
+// See https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md
+package cast
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	Version     = 2
+	EventOutput = "o"
+	EventResize = "r"
+)
+
+// Header is a first line of asciicast file.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is a output or resize of terminal at given time.
+type Event struct {
+	Time float64 // seconds from start of the session
+	Type string
+	Data string
+}
+
+// MarshalJSON encodes a event to [time, type, data]
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Time, e.Type, e.Data})
+}
+
+// UnmarshalJSON decodes a event from [time, type, data]
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var fields []interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("invalid event: %s", string(b))
+	}
+	t, ok1 := fields[0].(float64)
+	typ, ok2 := fields[1].(string)
+	data, ok3 := fields[2].(string)
+	if !ok1 || !ok2 || !ok3 {
+		return fmt.Errorf("invalid event: %s", string(b))
+	}
+	e.Time, e.Type, e.Data = t, typ, data
+	return nil
+}
+
+// Recorder writes terminal outputs with timestamps as asciicast.
+// Recorder is started by Start and then can be used as io.Writer of outputs.
+type Recorder struct {
+	mu      sync.Mutex
+	w       io.Writer
+	title   string
+	started time.Time
+	encoder *json.Encoder
+	// pending is an incomplete utf-8 sequence at the end of the last output
+	pending []byte
+	// err stops recording without failing outputs of the session
+	err error
+}
+
+// NewRecorder returns a new Recorder writing to given writer.
+func NewRecorder(w io.Writer, title string) *Recorder {
+	return &Recorder{
+		w:       w,
+		title:   title,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Start writes a header with terminal size.
+func (r *Recorder) Start(width, height int, env map[string]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.started.IsZero() {
+		return errors.New("already started")
+	}
+	r.started = time.Now()
+	return r.encoder.Encode(&Header{
+		Version:   Version,
+		Width:     width,
+		Height:    height,
+		Timestamp: r.started.Unix(),
+		Title:     r.title,
+		Env:       env,
+	})
+}
+
+// Write records given output. A multibyte character split across writes is kept until completed.
+// Recording is stopped on an error which is returned by Err, so Write never fails.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return len(p), nil
+	}
+	data := append(r.pending, p...)
+	n := completeLength(data)
+	r.pending = append([]byte(nil), data[n:]...)
+	if n > 0 {
+		r.writeEvent(EventOutput, string(data[:n]))
+	}
+	return len(p), nil
+}
+
+// Resize records a new terminal size.
+func (r *Recorder) Resize(width, height int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.writeEvent(EventResize, fmt.Sprintf("%dx%d", width, height))
+	return r.err
+}
+
+// Err returns an error which stopped recording.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// writeEvent writes an event unless stopped. The caller must hold the lock.
+func (r *Recorder) writeEvent(typ, data string) {
+	if r.err != nil {
+		return
+	}
+	if r.started.IsZero() {
+		r.err = errors.New("recorder is not started")
+		return
+	}
+	r.err = r.encoder.Encode(Event{
+		Time: time.Since(r.started).Seconds(),
+		Type: typ,
+		Data: data,
+	})
+}
+
+// completeLength returns a length of given bytes without an incomplete utf-8 sequence at the end.
+func completeLength(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(p)
+}
+
+// Read returns a header and events from given asciicast reader.
+func Read(r io.Reader) (*Header, []Event, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errors.New("empty asciicast")
+	}
+	var header Header
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, nil, err
+	}
+	if header.Version != Version {
+		return nil, nil, fmt.Errorf("unsupported asciicast version %d", header.Version)
+	}
+
+	var events []Event
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, nil, err
+		}
+		events = append(events, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return &header, events, nil
+}
+
+// Duration returns a elapsed time of given events.
+func Duration(events []Event) time.Duration {
+	if len(events) == 0 {
+		return 0
+	}
+	return time.Duration(events[len(events)-1].Time * float64(time.Second))
+}
+
+// Play writes outputs of events to given writer with recorded timings.
+// The speed is a multiplier of playback and idle times are limited to maxIdle if greater than zero.
+func Play(w io.Writer, events []Event, speed float64, maxIdle time.Duration) error {
+	if speed <= 0 {
+		speed = 1
+	}
+	prev := 0.0
+	for _, e := range events {
+		delay := time.Duration((e.Time - prev) / speed * float64(time.Second))
+		if maxIdle > 0 && delay > maxIdle {
+			delay = maxIdle
+		}
+		prev = e.Time
+		time.Sleep(delay)
+
+		if e.Type != EventOutput {
+			continue
+		}
+		if _, err := io.WriteString(w, e.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/zacscoding/myutils/audit"
+	"github.com/zacscoding/myutils/types"
+	"github.com/zacscoding/myutils/utils"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+)
+
+var (
+	auditFilterFlags = []cli.Flag{
+		utils.AuditHostFlag,
+		utils.AuditSinceFlag,
+		utils.AuditUntilFlag,
+		utils.AuditLimitFlag,
+	}
+
+	auditCommand = cli.Command{
+		Action:   ShowSubCommand,
+		Name:     "audit",
+		Usage:    "show audit log of executed remote commands such as list | show | export",
+		Category: "SSH COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List audit records",
+				Action: listAudits,
+				Flags:  auditFilterFlags,
+			},
+			{
+				Name:      "show",
+				Usage:     "Show an audit record with results of hosts",
+				Action:    showAudit,
+				ArgsUsage: "[audit id]",
+			},
+			{
+				Name:   "export",
+				Usage:  "Export audit records to json file",
+				Action: exportAudits,
+				Flags:  append([]cli.Flag{utils.PathFlag}, auditFilterFlags...),
+			},
+		},
+	}
+)
+
+// recordAudit save an audit record of a remote command. Failures are only logged
+// not to fail the command already executed.
+func recordAudit(a *types.Audit) {
+	a.User = utils.CurrentUser()
+	store, err := app.store()
+	if err == nil {
+		err = audit.AddAudit(store, a)
+	}
+	if err != nil {
+		log.Printf("[WARN] failed to record audit log. %v\n", err)
+	}
+}
+
+// listAudits display audit records matched by filter flags.
+func listAudits(ctx *cli.Context) error {
+	audits, err := getAudits(ctx)
+	if err != nil {
+		return err
+	}
+	if len(audits) == 0 {
+		log.Printf("> empty audit records")
+		return nil
+	}
+	for _, a := range audits {
+		failures := 0
+		for _, r := range a.Hosts {
+			if r.ExitStatus != 0 {
+				failures++
+			}
+		}
+		log.Printf("%s -> %s %s by %s, hosts : %d, failures : %d, duration : %v, command : %s\n",
+			a.ID, a.Time.Format(time.RFC3339), a.Action, a.User, len(a.Hosts), failures, a.Duration, a.Command)
+	}
+	return nil
+}
+
+// showAudit display an audit record with results of hosts.
+func showAudit(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("required args [audit id]")
+	}
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	a, err := audit.GetAudit(store, ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	log.Printf("id : %s, time : %s, user : %s, duration : %v\n", a.ID, a.Time.Format(time.RFC3339), a.User, a.Duration)
+	log.Printf("%s : %s\n", a.Action, a.Command)
+	for _, r := range a.Hosts {
+		if r.Error != "" {
+			log.Printf("  %s -> exit status : %d, duration : %v, error : %s\n", r.Host, r.ExitStatus, r.Duration, r.Error)
+		} else {
+			log.Printf("  %s -> exit status : %d, duration : %v\n", r.Host, r.ExitStatus, r.Duration)
+		}
+	}
+	return nil
+}
+
+// exportAudits write audit records matched by filter flags to a json file.
+func exportAudits(ctx *cli.Context) error {
+	path := ctx.String(utils.PathFlag.Name)
+	if path == "" {
+		return errors.New(`path must not be ""`)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return errors.New("already exist file :" + path)
+	}
+	audits, err := getAudits(ctx)
+	if err != nil {
+		return err
+	}
+	if audits == nil {
+		audits = []*types.Audit{}
+	}
+	b, err := json.MarshalIndent(audits, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		return err
+	}
+	log.Printf("success to export %d audit records. destination : %s\n", len(audits), path)
+	return nil
+}
+
+// getAudits returns audit records matched by filter flags.
+func getAudits(ctx *cli.Context) ([]*types.Audit, error) {
+	since, err := parseTimeFlag(ctx.String(utils.AuditSinceFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseTimeFlag(ctx.String(utils.AuditUntilFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	store, err := app.store()
+	if err != nil {
+		return nil, err
+	}
+	return audit.GetAudits(store, &audit.Filter{
+		Host:  ctx.String(utils.AuditHostFlag.Name),
+		Since: since,
+		Until: until,
+		Limit: ctx.Int(utils.AuditLimitFlag.Name),
+	})
+}
+
+// parseTimeFlag parses a time given RFC3339, local date("2006-01-02"), local datetime("2006-01-02 15:04")
+// or a duration before now("24h"). Returns zero time if empty.
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s. use RFC3339, 2006-01-02, \"2006-01-02 15:04\" or a duration like 24h", value)
+}
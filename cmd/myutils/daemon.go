@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const daemonStartTimeout = 5 * time.Second
+
+// ensureDaemon starts "myutils [command] daemon [args...]" in background if not ready and waits until ready.
+// Outputs of the daemon are appended to given log file.
+func ensureDaemon(command, logPath string, ready func() bool, args ...string) error {
+	if ready() {
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(executable, append([]string{command, "daemon"}, args...)...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = daemonSysProcAttr()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.Printf("> started %s daemon. pid : %d, log : %s\n", command, cmd.Process.Pid, logPath)
+	_ = cmd.Process.Release()
+
+	deadline := time.Now().Add(daemonStartTimeout)
+	for time.Now().Before(deadline) {
+		if ready() {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return fmt.Errorf("%s daemon is not ready in %v. see %s", command, daemonStartTimeout, logPath)
+}
@@ -0,0 +1,8 @@
+package main
+
+import "syscall"
+
+// daemonSysProcAttr returns attributes to detach a daemon process from current console.
+func daemonSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
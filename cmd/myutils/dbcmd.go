@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/migration"
+	"github.com/zacscoding/myutils/utils"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const backupTimeLayout = "20060102-150405"
+
+var (
+	dbCommand = cli.Command{
+		Action:   ShowSubCommand,
+		Name:     "db",
+		Usage:    "manage local store such as migrate | backup | restore | compact | stats",
+		Category: "STORE COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "migrate",
+				Usage:  "Migrate stored records to the latest schema version",
+				Action: migrateStore,
+				Flags: []cli.Flag{
+					utils.DryRunFlag,
+				},
+			},
+			{
+				Name:   "backup",
+				Usage:  "Backup a consistent snapshot of local store to an archive",
+				Action: backupStore,
+				Flags: []cli.Flag{
+					utils.BackupPathFlag,
+				},
+			},
+			{
+				Name:      "restore",
+				Usage:     "Restore local store from a backup archive. current store is backed up before",
+				Action:    restoreStore,
+				ArgsUsage: "[backup archive path]",
+			},
+			{
+				Name:   "compact",
+				Usage:  "Compact underlying storage of local store",
+				Action: compactStore,
+			},
+			{
+				Name:   "stats",
+				Usage:  "Display key counts per prefix of local store",
+				Action: showStoreStats,
+			},
+		},
+	}
+)
+
+// migrateStore applies pending migrations or displays them if dry run.
+func migrateStore(ctx *cli.Context) error {
+	store, err := app.openStore()
+	if err != nil {
+		return err
+	}
+	current, err := migration.GetVersion(store)
+	if err != nil {
+		return err
+	}
+	dryRun := ctx.Bool(utils.DryRunFlag.Name)
+	log.Printf("> schema version : %d, latest : %d\n", current, migration.LatestVersion())
+
+	results, err := migration.Run(store, dryRun)
+	for _, result := range results {
+		if dryRun {
+			log.Printf("[dry-run] version %d : %s, changes : %d\n", result.Version, result.Description, len(result.Changes))
+		} else {
+			log.Printf("migrated version %d : %s, changes : %d\n", result.Version, result.Description, len(result.Changes))
+		}
+		for _, change := range result.Changes {
+			log.Printf("  - %s\n", change)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		log.Println("> already up to date")
+	}
+	return nil
+}
+
+// backupStore writes a snapshot of local store to a given path or backups directory.
+func backupStore(ctx *cli.Context) error {
+	store, err := app.openStore()
+	if err != nil {
+		return err
+	}
+	path, manifest, err := backupTo(store, ctx.String(utils.BackupPathFlag.Name))
+	if err != nil {
+		return err
+	}
+	log.Printf("> backup %d entries to %s (sha256 : %s)\n", manifest.Entries, path, manifest.SHA256)
+	return nil
+}
+
+// restoreStore verifies a backup archive and replaces local store with it.
+func restoreStore(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("required args [backup archive path]")
+	}
+	f, err := os.Open(ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	manifest, entries, err := db.ReadBackup(f)
+	if err != nil {
+		return err
+	}
+
+	store, err := app.openStore()
+	if err != nil {
+		return err
+	}
+	// keep current store to recover from a wrong restore
+	path, _, err := backupTo(store, "")
+	if err != nil {
+		return fmt.Errorf("failed to backup current store before restore. %v", err)
+	}
+	log.Println("> current store is backed up to", path)
+
+	if err := db.Restore(store, entries); err != nil {
+		return err
+	}
+	log.Printf("> restored %d entries created at %s\n", manifest.Entries, manifest.CreatedAt.Format(time.RFC3339))
+	return nil
+}
+
+// backupTo writes a snapshot of a store to path or a new file in backups directory if path is empty.
+func backupTo(store db.Store, path string) (string, *db.Manifest, error) {
+	if path == "" {
+		dir, err := utils.GetBackupsPath()
+		if err != nil {
+			return "", nil, err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", nil, err
+		}
+		path = filepath.Join(dir, "myutils-"+time.Now().Format(backupTimeLayout)+".tar.gz")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return "", nil, errors.New("already exist file :" + path)
+	}
+
+	snapshot, err := store.NewSnapshot()
+	if err != nil {
+		return "", nil, err
+	}
+	defer snapshot.Release()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", nil, err
+	}
+	manifest, err := db.Backup(snapshot, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return "", nil, err
+	}
+	return path, manifest, nil
+}
+
+// compactStore compacts underlying storage if supported by the backend.
+func compactStore(ctx *cli.Context) error {
+	store, err := app.openStore()
+	if err != nil {
+		return err
+	}
+	compacter, ok := store.(db.Compacter)
+	if !ok {
+		return fmt.Errorf("compaction is not supported by %s backend", utils.GetDatabaseBackend())
+	}
+	start := time.Now()
+	if err := compacter.Compact(); err != nil {
+		return err
+	}
+	log.Printf("> compacted in %v\n", time.Since(start))
+	return nil
+}
+
+// showStoreStats display key counts and value bytes per key prefix i.e "host.".
+func showStoreStats(ctx *cli.Context) error {
+	store, err := app.openStore()
+	if err != nil {
+		return err
+	}
+	snapshot, err := store.NewSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+
+	type stat struct {
+		keys  int
+		bytes int
+	}
+	stats := make(map[string]*stat)
+	itr := snapshot.NewIteratorWithPrefix(nil)
+	for itr.Next() {
+		key := string(itr.Key())
+		prefix := key
+		if idx := strings.IndexRune(key, '.'); idx != -1 {
+			prefix = key[:idx+1]
+		}
+		s, ok := stats[prefix]
+		if !ok {
+			s = &stat{}
+			stats[prefix] = s
+		}
+		s.keys++
+		s.bytes += len(itr.Value())
+	}
+	itr.Release()
+	if err := itr.Error(); err != nil {
+		return err
+	}
+
+	prefixes := make([]string, 0, len(stats))
+	for prefix := range stats {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	backend := utils.GetDatabaseBackend()
+	path, _ := utils.GetDatabasePath(backend)
+	version, _ := migration.GetVersion(snapshot)
+	log.Printf("> backend : %s, path : %s, size : %d bytes, schema version : %d\n", backend, path, diskUsage(path), version)
+	total := 0
+	for _, prefix := range prefixes {
+		log.Printf("%-10s keys : %d, value bytes : %d\n", prefix, stats[prefix].keys, stats[prefix].bytes)
+		total += stats[prefix].keys
+	}
+	log.Printf("> total keys : %d\n", total)
+	return nil
+}
+
+// diskUsage returns total size of files in a given path.
+func diskUsage(path string) int64 {
+	var size int64
+	_ = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/urfave/cli"
 	"github.com/zacscoding/myutils/host"
+	"github.com/zacscoding/myutils/tunnel"
 	"github.com/zacscoding/myutils/types"
 	"github.com/zacscoding/myutils/utils"
 	"io/ioutil"
@@ -12,23 +14,42 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 )
 
 var (
-	hostFlags = []cli.Flag{
-		utils.HostNameFlag,
+	hostFlags = append([]cli.Flag{utils.HostNameFlag}, hostFieldFlags...)
+
+	// hostFieldFlags are flags of host fields except name
+	hostFieldFlags = []cli.Flag{
 		utils.HostUserFlag,
 		utils.HostAddressFlag,
 		utils.HostPortFlag,
 		utils.HostPasswordFlag,
 		utils.HostPemPathFlag,
 		utils.HostDescriptionFLag,
+		utils.HostTagFlag,
+		utils.HostForwardAgentFlag,
+		utils.HostKeepAliveFlag,
+		utils.HostKeepAliveMaxMissedFlag,
+	}
+
+	// unsetFieldFlags are flags of fields to be cleared by --unset
+	unsetFieldFlags = map[string]cli.Flag{
+		"password":             utils.HostPasswordFlag,
+		"keypath":              utils.HostPemPathFlag,
+		"description":          utils.HostDescriptionFLag,
+		"tags":                 utils.HostTagFlag,
+		"forward-agent":        utils.HostForwardAgentFlag,
+		"keepalive":            utils.HostKeepAliveFlag,
+		"keepalive-max-missed": utils.HostKeepAliveMaxMissedFlag,
 	}
 
 	hostCommand = cli.Command{
 		Action:   ShowSubCommand,
 		Name:     "host",
-		Usage:    "manage hosts such as add | get | gets | update | delete",
+		Usage:    "manage hosts such as add | get | gets | update | delete | rename | clone | validate | tag | history | revert",
 		Category: "HOST COMMANDS",
 		Subcommands: []cli.Command{
 			{
@@ -61,15 +82,24 @@ var (
 			},
 			{
 				Name:   "gets",
-				Usage:  "Get hosts",
+				Usage:  "Get hosts matched by query flags",
 				Action: showHosts,
-				Flags:  hostFlags,
+				Flags: []cli.Flag{
+					utils.QueryNameFlag,
+					utils.QueryAddressFlag,
+					utils.QueryUserFlag,
+					utils.QueryTagFlag,
+					utils.QueryTextFlag,
+					utils.QuerySortFlag,
+					utils.QueryLimitFlag,
+					utils.QueryOffsetFlag,
+				},
 			},
 			{
 				Name:   "update",
-				Usage:  "Update a host",
+				Usage:  "Update fields of a host given by flags",
 				Action: updateHost,
-				Flags:  hostFlags,
+				Flags:  append(hostFlags, utils.UnsetFieldFlag),
 			},
 			{
 				Name:   "delete",
@@ -77,6 +107,49 @@ var (
 				Action: deleteHost,
 				Flags:  hostFlags,
 			},
+			{
+				Name:      "rename",
+				Usage:     "Rename a host with history and tunnels over it",
+				Action:    renameHost,
+				ArgsUsage: "[host name] [new name]",
+			},
+			{
+				Name:      "clone",
+				Usage:     "Copy a host with a new name and overrides given by flags",
+				Action:    cloneHost,
+				ArgsUsage: "[source host name] [new name]",
+				Flags:     hostFieldFlags,
+			},
+			{
+				Name:   "validate",
+				Usage:  "Check all hosts in local store are valid",
+				Action: validateHosts,
+			},
+			{
+				Name:      "tag",
+				Usage:     "Add or remove tags of hosts at once",
+				Action:    tagHosts,
+				ArgsUsage: "[host names...]",
+				Flags: []cli.Flag{
+					utils.AddTagFlag,
+					utils.RemoveTagFlag,
+				},
+			},
+			{
+				Name:      "history",
+				Usage:     "Show change history of a host",
+				Action:    showHostHistory,
+				ArgsUsage: "[host name]",
+			},
+			{
+				Name:      "revert",
+				Usage:     "Revert a host to a version of history",
+				Action:    revertHost,
+				ArgsUsage: "[host name]",
+				Flags: []cli.Flag{
+					utils.RevertVersionFlag,
+				},
+			},
 		},
 	}
 )
@@ -106,7 +179,11 @@ func exportHosts(ctx *cli.Context) error {
 		path = filepath.Join(path, "hosts.json")
 	}
 
-	hosts, err := host.GetHosts(app.db)
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	hosts, err := host.GetHosts(store)
 	if err != nil {
 		return err
 	}
@@ -148,17 +225,15 @@ func importHosts(ctx *cli.Context) error {
 		return err
 	}
 
-	var failures []string
-	for _, h := range hosts {
-		err = host.AddHost(app.db, h)
-
-		if err != nil {
-			failures = append(failures, h.Name)
-			continue
-		}
+	store, err := app.store()
+	if err != nil {
+		return err
 	}
-
-	log.Printf("import hosts result >> try : %d / failures : %d. >>>> %v\n", len(hosts), len(failures), failures)
+	// import all hosts or nothing
+	if err := host.AddHosts(store, hosts); err != nil {
+		return fmt.Errorf("failed to import hosts. nothing is imported. %v", displayValidationError(err))
+	}
+	log.Printf("import hosts result >> success : %d\n", len(hosts))
 	return nil
 }
 
@@ -168,7 +243,11 @@ func addHost(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	return host.AddHost(app.db, h)
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	return displayValidationError(host.AddHost(store, h))
 }
 
 // showHost display a host given query.
@@ -181,7 +260,11 @@ func showHost(ctx *cli.Context) error {
 		return errors.New("hostname must be not empty")
 	}
 
-	h, err = host.GetHost(app.db, h.Name)
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	h, err = host.GetHost(store, h.Name)
 	if err != nil {
 		return nil
 	}
@@ -191,21 +274,71 @@ func showHost(ctx *cli.Context) error {
 
 // showHosts display all hosts from local store.
 func showHosts(ctx *cli.Context) error {
-	hosts, err := host.GetHosts(app.db)
+	store, err := app.store()
 	if err != nil {
-		return nil
+		return err
+	}
+	hosts, total, err := host.FindHosts(store, &host.Query{
+		Names:   ctx.StringSlice("name"),
+		Address: ctx.String("address"),
+		User:    ctx.String("user"),
+		Tags:    ctx.StringSlice("tag"),
+		Text:    ctx.String("text"),
+		Sort:    ctx.String("sort"),
+		Limit:   ctx.Int("limit"),
+		Offset:  ctx.Int("offset"),
+	})
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		log.Printf("> no hosts matched\n")
+	} else {
+		displayHost(hosts...)
+	}
+	if len(hosts) != total {
+		log.Printf("> %d of %d matched hosts\n", len(hosts), total)
 	}
-	displayHost(hosts...)
 	return nil
 }
 
 // updateHost update a host parsed from cli into local stored.
 func updateHost(ctx *cli.Context) error {
-	h, err := parseHost(ctx)
+	name := ctx.String("name")
+	if name == "" {
+		return errors.New("required host name")
+	}
+	unset := ctx.StringSlice("unset")
+	for _, field := range unset {
+		if flag, ok := unsetFieldFlags[field]; ok && isFlagSet(ctx, flag) {
+			return fmt.Errorf("cannot set and unset a field %s", field)
+		}
+	}
+	store, err := app.store()
 	if err != nil {
 		return err
 	}
-	return host.UpdateHost(app.db, h)
+	diff, err := host.EditHost(store, name, func(h *types.Host) error {
+		applyHostFlags(ctx, h)
+		for _, field := range unset {
+			if err := host.UnsetField(h, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return displayValidationError(err)
+	}
+	if len(diff) == 0 {
+		log.Printf("No changes of a host %s\n", name)
+		return nil
+	}
+	log.Printf("Success to update a host %s\n", name)
+	for _, d := range diff {
+		log.Printf("  %s\n", d)
+	}
+	return nil
 }
 
 // deleteHost delete a host parsed from cli.
@@ -214,23 +347,231 @@ func deleteHost(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	return host.DeleteHost(app.db, h.Name)
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	return host.DeleteHost(store, h.Name)
+}
+
+// renameHost rename a host and tunnels referencing it atomically.
+func renameHost(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return errors.New("required args [host name] [new name]")
+	}
+	oldName, newName := ctx.Args()[0], ctx.Args()[1]
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	snapshot, err := store.NewSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+
+	batch := store.NewBatch()
+	if _, err := host.RenameHost(snapshot, batch, oldName, newName); err != nil {
+		return err
+	}
+	tunnels, err := tunnel.RenameHost(snapshot, batch, oldName, newName)
+	if err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Printf("Success to rename a host %s to %s\n", oldName, newName)
+	for _, t := range tunnels {
+		log.Printf("> tunnel %s is updated to use %s\n", t.Name, newName)
+	}
+	return nil
+}
+
+// cloneHost save a copy of a host with a new name and fields given by flags.
+func cloneHost(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return errors.New("required args [source host name] [new name]")
+	}
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	h, err := host.CloneHost(store, ctx.Args()[0], ctx.Args()[1], func(h *types.Host) {
+		applyHostFlags(ctx, h)
+	})
+	if err != nil {
+		return displayValidationError(err)
+	}
+	log.Printf("Success to clone a host %s to %s\n", ctx.Args()[0], h.Name)
+	displayHost(h)
+	return nil
+}
+
+// validateHosts display invalid fields of all hosts in local store.
+func validateHosts(ctx *cli.Context) error {
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	hosts, err := host.GetHosts(store)
+	if err != nil {
+		return err
+	}
+	if err := displayValidationError(host.ValidateHosts(hosts)); err != nil {
+		return err
+	}
+	log.Printf("All %d hosts are valid\n", len(hosts))
+	return nil
+}
+
+// displayValidationError show each invalid field of a validation error
+// and returns an error with the number of invalid fields instead.
+func displayValidationError(err error) error {
+	validationErr, ok := err.(host.ValidationError)
+	if !ok {
+		return err
+	}
+	for _, fe := range validationErr {
+		log.Printf("> %s: %s %s\n", fe.Host, fe.Field, fe.Message)
+	}
+	return fmt.Errorf("found %d invalid field(s)", len(validationErr))
+}
+
+// tagHosts add or remove tags of given hosts atomically.
+func tagHosts(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errors.New("required args [host names...]")
+	}
+	add := ctx.StringSlice(utils.AddTagFlag.Name)
+	remove := ctx.StringSlice(utils.RemoveTagFlag.Name)
+	if len(add) == 0 && len(remove) == 0 {
+		return errors.New("required --add or --remove tags")
+	}
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	hosts, err := host.TagHosts(store, ctx.Args(), add, remove)
+	if err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		log.Printf("%s -> tags : %v\n", h.Name, h.Tags)
+	}
+	return nil
+}
+
+// showHostHistory display versions of a host with changed fields.
+func showHostHistory(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("required args [host name]")
+	}
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	histories, err := host.GetHistory(store, ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	if len(histories) == 0 {
+		log.Printf("> empty history of host %s\n", ctx.Args()[0])
+		return nil
+	}
+	for _, h := range histories {
+		displayHistory(h)
+	}
+	return nil
+}
+
+// revertHost revert a host to a given version or before the latest change.
+func revertHost(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("required args [host name]")
+	}
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	history, err := host.RevertHost(store, ctx.Args()[0], ctx.Int(utils.RevertVersionFlag.Name))
+	if err != nil {
+		return err
+	}
+	displayHistory(history)
+	return nil
+}
+
+// displayHistory show a version of host history to console.
+func displayHistory(h *types.History) {
+	log.Printf("v%d %s %s by %s\n", h.Version, h.Time.Format(time.RFC3339), h.Action, h.User)
+	for _, d := range h.Diff {
+		log.Printf("  %s\n", d)
+	}
 }
 
 // Parse host from given cli.Context.
 func parseHost(ctx *cli.Context) (*types.Host, error) {
 	host := &types.Host{
-		Name:        ctx.String("name"),
-		User:        ctx.String("user"),
-		Address:     ctx.String("address"),
-		Port:        ctx.Int("port"),
-		Password:    ctx.String("password"),
-		KeyPath:     ctx.String("keypath"),
-		Description: ctx.String("description"),
+		Name:               ctx.String("name"),
+		User:               ctx.String("user"),
+		Address:            ctx.String("address"),
+		Port:               ctx.Int("port"),
+		Password:           ctx.String("password"),
+		KeyPath:            ctx.String("keypath"),
+		Description:        ctx.String("description"),
+		Tags:               ctx.StringSlice("tag"),
+		ForwardAgent:       ctx.Bool("forward-agent"),
+		KeepAlive:          ctx.Int("keepalive"),
+		KeepAliveMaxMissed: ctx.Int("keepalive-max-missed"),
 	}
 	return host, nil
 }
 
+// applyHostFlags sets fields of a host given by flags only if the flags are set.
+func applyHostFlags(ctx *cli.Context, h *types.Host) {
+	if isFlagSet(ctx, utils.HostUserFlag) {
+		h.User = ctx.String("user")
+	}
+	if isFlagSet(ctx, utils.HostAddressFlag) {
+		h.Address = ctx.String("address")
+	}
+	if isFlagSet(ctx, utils.HostPortFlag) {
+		h.Port = ctx.Int("port")
+	}
+	if isFlagSet(ctx, utils.HostPasswordFlag) {
+		h.Password = ctx.String("password")
+	}
+	if isFlagSet(ctx, utils.HostPemPathFlag) {
+		h.KeyPath = ctx.String("keypath")
+	}
+	if isFlagSet(ctx, utils.HostDescriptionFLag) {
+		h.Description = ctx.String("description")
+	}
+	if isFlagSet(ctx, utils.HostTagFlag) {
+		h.Tags = ctx.StringSlice("tag")
+	}
+	if isFlagSet(ctx, utils.HostForwardAgentFlag) {
+		h.ForwardAgent = ctx.Bool("forward-agent")
+	}
+	if isFlagSet(ctx, utils.HostKeepAliveFlag) {
+		h.KeepAlive = ctx.Int("keepalive")
+	}
+	if isFlagSet(ctx, utils.HostKeepAliveMaxMissedFlag) {
+		h.KeepAliveMaxMissed = ctx.Int("keepalive-max-missed")
+	}
+}
+
+// isFlagSet returns true if a flag is set by any of own names i.e "address" or "a".
+func isFlagSet(ctx *cli.Context, flag cli.Flag) bool {
+	for _, name := range strings.Split(flag.GetName(), ",") {
+		if ctx.IsSet(strings.TrimSpace(name)) {
+			return true
+		}
+	}
+	return false
+}
+
 // displayHost show all hosts to console.
 func displayHost(hosts ...*types.Host) {
 	if hosts == nil || len(hosts) == 0 {
@@ -5,20 +5,27 @@ import (
 	"fmt"
 	"github.com/urfave/cli"
 	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/migration"
+	"github.com/zacscoding/myutils/remote"
 	"github.com/zacscoding/myutils/utils"
 	"log"
 	"os"
+	"time"
 )
 
 type App struct {
 	cliApp *cli.App
-	db     *db.Database
+
+	// local store is opened on demand and should be closed as soon as possible,
+	// because it is locked while opened and other myutils processes wait for it.
+	db          db.Store
+	openTimeout time.Duration
 }
 
 var (
 	app = &App{
-		cliApp: utils.NewApp(),
-		db:     createDatabase(),
+		cliApp:      utils.NewApp(),
+		openTimeout: utils.DBTimeoutFlag.Value,
 	}
 )
 
@@ -26,36 +33,86 @@ func init() {
 	app.cliApp.Action = func(ctx *cli.Context) error {
 		return cli.ShowAppHelp(ctx)
 	}
+	app.cliApp.Flags = []cli.Flag{
+		utils.DBTimeoutFlag,
+	}
+	app.cliApp.Before = func(ctx *cli.Context) error {
+		app.openTimeout = ctx.GlobalDuration(utils.DBTimeoutFlag.Name)
+		return nil
+	}
 
 	app.cliApp.Commands = []cli.Command{
 		hostCommand,
 		sshCommand,
 		scpCommand,
+		sessionsCommand,
+		tunnelCommand,
+		muxCommand,
+		auditCommand,
+		dbCommand,
+	}
+
+	// use connections of multiplexing daemon if running
+	if path, err := utils.GetMuxSocketPath(); err == nil {
+		remote.MuxSocketPath = path
 	}
 }
 
 func main() {
 	err := app.cliApp.Run(os.Args)
-	defer app.db.Close()
+	app.closeStore()
 	if err != nil {
 		_, _ = fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
-// createDataStore returns a db
-func createDatabase() *db.Database {
-	path, err := utils.GetDatabasePath()
+// store returns a local store of backend configured by MYUTILS_DB_BACKEND.
+// Opens the store and migrates records to the latest schema on first call.
+func (a *App) store() (db.Store, error) {
+	if a.db != nil {
+		return a.db, nil
+	}
+	store, err := a.openStore()
 	if err != nil {
-		log.Fatal("Failed to create data store.", err)
-		os.Exit(1)
+		return nil, err
 	}
-	database, err := db.NewDatabase(path, nil)
+	results, err := migration.Run(store, false)
 	if err != nil {
-		log.Fatal("Failed to create data store.", err)
-		os.Exit(1)
+		a.closeStore()
+		return nil, err
+	}
+	for _, result := range results {
+		log.Printf("migrated local store to schema version %d : %s\n", result.Version, result.Description)
+	}
+	return store, nil
+}
+
+// openStore opens a local store without migrations.
+// Waits while another process holds the store until timeout.
+func (a *App) openStore() (db.Store, error) {
+	if a.db != nil {
+		return a.db, nil
+	}
+	backend := utils.GetDatabaseBackend()
+	path, err := utils.GetDatabasePath(backend)
+	if err != nil {
+		return nil, err
+	}
+	store, err := db.OpenWithTimeout(backend, path, a.openTimeout)
+	if err != nil {
+		return nil, err
+	}
+	a.db = store
+	return store, nil
+}
+
+// closeStore closes a local store if opened so other processes can use it.
+func (a *App) closeStore() {
+	if a.db != nil {
+		a.db.Close()
+		a.db = nil
 	}
-	return database
 }
 
 // ShowSubCommand display sub commands help
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/zacscoding/myutils/host"
+	"github.com/zacscoding/myutils/remote"
+	"github.com/zacscoding/myutils/types"
+	"github.com/zacscoding/myutils/utils"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	// muxStoreMu serializes access to the local store of multiplexing daemon
+	muxStoreMu sync.Mutex
+
+	muxCommand = cli.Command{
+		Action:   ShowSubCommand,
+		Name:     "mux",
+		Usage:    "keep ssh connections in background and reuse them [start | stop | status]",
+		Category: "SSH COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "start",
+				Usage:  "Start multiplexing daemon",
+				Action: startMux,
+				Flags: []cli.Flag{
+					utils.MuxIdleTimeoutFlag,
+				},
+			},
+			{
+				Name:   "stop",
+				Usage:  "Stop multiplexing daemon and close all connections",
+				Action: stopMux,
+			},
+			{
+				Name:   "status",
+				Usage:  "Show connections kept by multiplexing daemon",
+				Action: showMuxStatus,
+			},
+			{
+				Name:   "daemon",
+				Usage:  "Run multiplexing daemon in foreground",
+				Action: runMuxDaemon,
+				Hidden: true,
+				Flags: []cli.Flag{
+					utils.MuxIdleTimeoutFlag,
+				},
+			},
+		},
+	}
+)
+
+// startMux starts multiplexing daemon in background if not running.
+func startMux(ctx *cli.Context) error {
+	logPath, err := utils.GetMuxLogPath()
+	if err != nil {
+		return err
+	}
+	idle := ctx.Duration(utils.MuxIdleTimeoutFlag.Name)
+	return ensureDaemon("mux", logPath, func() bool {
+		_, err := remote.SendMuxRequest(remote.MuxSocketPath, &remote.MuxRequest{Command: remote.MuxCommandStatus})
+		return err == nil
+	}, "--"+utils.MuxIdleTimeoutFlag.Name, idle.String())
+}
+
+// stopMux stops multiplexing daemon.
+func stopMux(ctx *cli.Context) error {
+	_, err := remote.SendMuxRequest(remote.MuxSocketPath, &remote.MuxRequest{Command: remote.MuxCommandShutdown})
+	if err != nil {
+		return fmt.Errorf("cannot connect to multiplexing daemon. %v", err)
+	}
+	log.Println("> multiplexing daemon is stopped")
+	return nil
+}
+
+// showMuxStatus display connections kept by multiplexing daemon.
+func showMuxStatus(ctx *cli.Context) error {
+	statuses, err := remote.SendMuxRequest(remote.MuxSocketPath, &remote.MuxRequest{Command: remote.MuxCommandStatus})
+	if err != nil {
+		return fmt.Errorf("cannot connect to multiplexing daemon. %v", err)
+	}
+	if len(statuses) == 0 {
+		log.Printf("> empty connections")
+	}
+	for i, status := range statuses {
+		log.Printf("%v -> %s(%s), sessions : %d, connected : %s, last used : %s\n", i+1, status.Host, status.Address,
+			status.Clients, status.Connected.Format(time.RFC3339), status.LastUsed.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// runMuxDaemon runs multiplexing daemon until shutdown or terminated.
+func runMuxDaemon(ctx *cli.Context) error {
+	server, err := remote.NewMuxServer(ctx.Duration(utils.MuxIdleTimeoutFlag.Name), loadMuxHost)
+	if err != nil {
+		return err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Printf("multiplexing daemon is terminated by %v\n", sig)
+		_ = os.Remove(remote.MuxSocketPath)
+		os.Exit(0)
+	}()
+	return server.Serve(remote.MuxSocketPath)
+}
+
+// loadMuxHost returns a host requested to multiplexing daemon from the local store.
+// The store is closed after loading so that other myutils processes can use it.
+func loadMuxHost(name string) (*types.Host, error) {
+	muxStoreMu.Lock()
+	defer muxStoreMu.Unlock()
+	store, err := app.store()
+	if err != nil {
+		return nil, err
+	}
+	defer app.closeStore()
+	return host.GetHost(store, name)
+}
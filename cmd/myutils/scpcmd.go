@@ -1,15 +1,21 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/pkg/sftp"
 	"github.com/urfave/cli"
 	"github.com/zacscoding/myutils/host"
 	"github.com/zacscoding/myutils/remote"
+	"github.com/zacscoding/myutils/types"
+	"github.com/zacscoding/myutils/utils"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 var (
@@ -19,9 +25,26 @@ var (
 		Usage:     "command for scp",
 		Category:  "SCP COMMANDS",
 		ArgsUsage: "[[hostname]:source] [[hostname]:destination]",
+		Flags: []cli.Flag{
+			utils.ScpDirectFlag,
+			utils.ScpPreserveFlag,
+			utils.ScpIncludeFlag,
+			utils.ScpExcludeFlag,
+			utils.ScpChecksumFlag,
+		},
 	}
 )
 
+// transferSummary is a result of scp
+type transferSummary struct {
+	Files         int
+	Dirs          int
+	Bytes         int64
+	OwnerFailures int      // number of files failed to preserve ownership
+	Verified      int      // number of files verified checksum
+	Mismatches    []string // destination files of checksum mismatch
+}
+
 func executeScpCommand(ctx *cli.Context) error {
 	if ctx.NArg() != 2 {
 		return errors.New("required args [[hostname]:source] [[hostname]:destination]")
@@ -34,66 +57,470 @@ func executeScpCommand(ctx *cli.Context) error {
 		return errors.New("cannot find a host in paths")
 	}
 
-	upload := true
-	hostName := srcHost
+	var (
+		summary *transferSummary
+		err     error
+		start   = time.Now()
+		opts    = copyOptions{
+			Preserve: ctx.Bool(utils.ScpPreserveFlag.Name),
+			Includes: ctx.StringSlice(utils.ScpIncludeFlag.Name),
+			Excludes: ctx.StringSlice(utils.ScpExcludeFlag.Name),
+			Checksum: ctx.Bool(utils.ScpChecksumFlag.Name),
+		}
+	)
+	switch {
+	case srcHost != "" && destHost != "":
+		// keep attributes of sources between hosts unless --preserve=false is given.
+		// umask of destination applies only if not preserving as with other copies.
+		if !isFlagSet(ctx, utils.ScpPreserveFlag) {
+			opts.Preserve = true
+		}
+		summary, err = copyBetweenHosts(srcHost, srcPath, destHost, destPath, ctx.Bool(utils.ScpDirectFlag.Name), opts)
+	case destHost != "":
+		summary, err = transferWithHost(destHost, func(client *remoteFS) (*transferSummary, error) {
+			return uploadFiles(srcPath, destPath, client, opts)
+		})
+	default:
+		summary, err = transferWithHost(srcHost, func(client *remoteFS) (*transferSummary, error) {
+			return downloadFiles(srcPath, destPath, client, opts)
+		})
+	}
+	if summary != nil {
+		fmt.Printf(">> Transferred files : %d, directories : %d, bytes : %d\n", summary.Files, summary.Dirs, summary.Bytes)
+		if opts.Checksum {
+			fmt.Printf(">> Verified checksum : %d, mismatches : %v\n", summary.Verified, summary.Mismatches)
+		}
+		if summary.OwnerFailures != 0 {
+			fmt.Printf(">> Cannot preserve ownership of %d files\n", summary.OwnerFailures)
+		}
+	}
+	recordScpAudit(ctx, []string{srcHost, destHost}, summary, err, start)
+	return err
+}
+
+// recordScpAudit records a scp invocation started at start with the result to audit log.
+func recordScpAudit(ctx *cli.Context, hostNames []string, summary *transferSummary, err error, start time.Time) {
+	duration := time.Since(start)
+	result := &types.AuditResult{Duration: duration}
+	switch {
+	case err != nil:
+		result.ExitStatus = 1
+		result.Error = err.Error()
+	case summary != nil && len(summary.Mismatches) != 0:
+		result.ExitStatus = 1
+		result.Error = fmt.Sprintf("checksum mismatches %v", summary.Mismatches)
+	}
+	a := &types.Audit{
+		Time:     start,
+		Action:   "scp",
+		Command:  strings.Join(append([]string{"scp"}, ctx.Args()...), " "),
+		Duration: duration,
+	}
+	for _, name := range hostNames {
+		if name == "" {
+			continue
+		}
+		r := *result
+		r.Host = name
+		a.Hosts = append(a.Hosts, &r)
+	}
+	recordAudit(a)
+}
+
+// splitPath returns a pair of "hostName" and "path"
+func splitPath(path string) (string, string) {
+	idx := strings.IndexRune(path, ':')
+	if idx == -1 {
+		return "", path
+	}
+	return path[:idx], path[idx+1:]
+}
 
-	if srcHost != "" {
-		upload = true
-		hostName = srcHost
+// transferWithHost connects sftp to a host with given name and calls transfer.
+func transferWithHost(hostName string, transfer func(client *remoteFS) (*transferSummary, error)) (*transferSummary, error) {
+	store, err := app.store()
+	if err != nil {
+		return nil, err
 	}
-	// getting host
-	h, err := host.GetHost(app.db, hostName)
+	h, err := host.GetHost(store, hostName)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// create sftp client
-	sc, err := remote.CreateSSHClient(h)
+	// release local store during the transfer
+	app.closeStore()
+
+	sc, client, err := newSftpClient(h)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer sc.Close()
+	defer client.Close()
+
+	return transfer(newRemoteFS(h.Name, sc, client))
+}
+
+// newSftpClient returns a ssh and sftp clients given a host.
+func newSftpClient(h *types.Host) (*remote.Client, *sftp.Client, error) {
+	sc, err := remote.CreateSSHClient(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sftp.NewClient(sc.Client)
+	if err != nil {
+		sc.Close()
+		return nil, nil, err
+	}
+	return sc, client, nil
+}
+
+// uploadFiles upload src file or directory to dest
+func uploadFiles(src, dest string, client *remoteFS, opts copyOptions) (*transferSummary, error) {
+	return copyFiles(localFS{}, src, client, dest, opts)
+}
+
+// downloadFiles download src file or directory from remote to dest
+func downloadFiles(src, dest string, client *remoteFS, opts copyOptions) (*transferSummary, error) {
+	return copyFiles(client, src, localFS{}, dest, opts)
+}
+
+// copyBetweenHosts copy src file or directory in srcHost to dest in destHost.
+// If direct is true, source host copies files to destination host with own scp command.
+// Otherwise, files are streamed from source host to destination host through the local machine.
+func copyBetweenHosts(srcHostName, src, destHostName, dest string, direct bool, opts copyOptions) (*transferSummary, error) {
+	store, err := app.store()
+	if err != nil {
+		return nil, err
+	}
+	srcHost, err := host.GetHost(store, srcHostName)
+	if err != nil {
+		return nil, err
+	}
+	destHost, err := host.GetHost(store, destHostName)
+	if err != nil {
+		return nil, err
+	}
+	// release local store during the transfer
+	app.closeStore()
+
+	if direct {
+		if len(opts.Includes) != 0 || len(opts.Excludes) != 0 || opts.Checksum {
+			return nil, errors.New("include, exclude and checksum options are not supported with direct copy")
+		}
+		return nil, copyDirectBetweenHosts(srcHost, src, destHost, dest, opts)
+	}
 
-	client, err := sftp.NewClient(sc)
+	srcConn, srcClient, err := newSftpClient(srcHost)
+	if err != nil {
+		return nil, err
+	}
+	defer srcConn.Close()
+	defer srcClient.Close()
+
+	destConn, destClient, err := newSftpClient(destHost)
+	if err != nil {
+		return nil, err
+	}
+	defer destConn.Close()
+	defer destClient.Close()
+
+	return copyFiles(newRemoteFS(srcHost.Name, srcConn, srcClient), src,
+		newRemoteFS(destHost.Name, destConn, destClient), dest, opts)
+}
+
+// copyDirectBetweenHosts executes scp command in srcHost to copy files to destHost.
+// The source host must be able to reach and authenticate to destination host by itself.
+func copyDirectBetweenHosts(srcHost *types.Host, src string, destHost *types.Host, dest string, opts copyOptions) error {
+	conn, client, err := newSftpClient(srcHost)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 	defer client.Close()
 
-	if upload {
-		return uploadFiles(srcPath, destPath, client)
+	// glob patterns in source are expanded via sftp so each match is quoted for shell of source host
+	sources := []string{src}
+	if hasGlobMeta(src) {
+		if sources, err = client.Glob(src); err != nil {
+			return err
+		}
+		if len(sources) == 0 {
+			return fmt.Errorf("no matches found: %s:%s", srcHost.Name, src)
+		}
+	}
+	srcArgs := make([]string, len(sources))
+	for i, source := range sources {
+		srcArgs[i] = shellQuote(source)
+	}
+
+	session, err := conn.NewSession()
+	if err != nil {
+		return err
 	}
-	return downloadFiles(srcPath, destPath, client)
+	defer session.Close()
+
+	var stdErr bytes.Buffer
+	session.Stdout = os.Stdout
+	session.Stderr = &stdErr
+
+	scpOpts := "-r"
+	if opts.Preserve {
+		scpOpts += " -p"
+	}
+	command := fmt.Sprintf("scp %s -o BatchMode=yes -P %d %s %s@%s:%s",
+		scpOpts, destHost.Port, strings.Join(srcArgs, " "), destHost.User, destHost.Address, shellQuote(dest))
+	fmt.Printf("> execute in %s : %s\n", srcHost.Name, command)
+	if err := session.Run(command); err != nil {
+		return fmt.Errorf("failed to copy from %s to %s. %v : %s", srcHost.Name, destHost.Name, err, stdErr.String())
+	}
+	return nil
 }
 
-// splitPath returns a pair of "hostName" and ""
-func splitPath(path string) (string, string) {
-	idx := strings.IndexRune(path, ':')
-	if idx == -1 {
-		return "", path
+// shellQuote returns a single quoted string for remote shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// copyOptions is options of copying files.
+type copyOptions struct {
+	// Preserve copies modes, access/modification times and ownership from sources.
+	// Otherwise, modes of sources are masked by umask of destination.
+	Preserve bool
+	// Includes are patterns of files to copy. If empty, all files are included.
+	Includes []string
+	// Excludes are patterns of files or directories to skip.
+	Excludes []string
+	// Checksum verifies SHA-256 of sources and destinations after copying each file.
+	Checksum bool
+}
+
+// matches returns true if a file with given slash separated relative path passes include and exclude patterns.
+// Patterns are matched with both base name and relative path and includes are applied to only files.
+func (o copyOptions) matches(rel string, isDir bool) bool {
+	for _, pattern := range o.Excludes {
+		if matchPattern(pattern, rel) {
+			return false
+		}
 	}
-	return path[:idx], path[idx+1:]
+	if isDir || len(o.Includes) == 0 {
+		return true
+	}
+	for _, pattern := range o.Includes {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
 }
 
-// uploadFiles upload src file or directory to dest
-func uploadFiles(src, dest string, client *sftp.Client) error {
-	fi, err := client.Open(dest)
+// matchPattern returns true if given pattern matches base name or whole of slash separated path.
+func matchPattern(pattern, rel string) bool {
+	if matched, _ := path.Match(pattern, path.Base(rel)); matched {
+		return true
+	}
+	matched, _ := path.Match(pattern, rel)
+	return matched
+}
+
+// validatePatterns returns an error if has a malformed pattern.
+func validatePatterns(patterns ...[]string) error {
+	for _, ps := range patterns {
+		for _, pattern := range ps {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %s. %v", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// hasGlobMeta returns true if given path has any of glob meta characters.
+func hasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, `*?[`)
+}
+
+// copyFiles copy src files or directories in srcFS to dest in destFS.
+// The src can be a glob pattern and if matched multiple sources, dest is a directory to copy into.
+// If dest is an existing directory, src is copied into it.
+func copyFiles(srcFS fileSystem, src string, destFS fileSystem, dest string, opts copyOptions) (*transferSummary, error) {
+	if err := validatePatterns(opts.Includes, opts.Excludes); err != nil {
+		return nil, err
+	}
+	if !hasGlobMeta(src) {
+		summary := &transferSummary{}
+		return summary, copyTree(srcFS, src, destFS, dest, opts, summary)
+	}
+
+	sources, err := srcFS.Glob(src)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return err
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no matches found: %s:%s", srcFS.Name(), src)
+	}
+	if len(sources) > 1 {
+		if err := destFS.MkdirAll(dest); err != nil {
+			return nil, fmt.Errorf("cannot create a directory %s:%s. %v", destFS.Name(), dest, err)
 		}
 	}
-	defer fi.Close()
 
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return errors.New(fmt.Sprintf("cannot access a file %s. %v\n", path, err))
+	summary := &transferSummary{}
+	for _, source := range sources {
+		if err := copyTree(srcFS, source, destFS, dest, opts, summary); err != nil {
+			return summary, err
 		}
-		//client.Create()
-		fmt.Println("Path :", path, ", isDir :", info.IsDir())
+	}
+	return summary, nil
+}
+
+// copyTree copy a src file or directory in srcFS to dest in destFS.
+// If dest is an existing directory, src is copied into it.
+func copyTree(srcFS fileSystem, src string, destFS fileSystem, dest string, opts copyOptions, summary *transferSummary) error {
+	srcInfo, err := srcFS.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !opts.matches(srcFS.Base(src), srcInfo.IsDir()) {
+		fmt.Printf("> skip a filtered file %s:%s\n", srcFS.Name(), src)
 		return nil
+	}
+	destInfo, err := destFS.Stat(dest)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil && destInfo.IsDir() {
+		dest = destFS.Join(dest, srcFS.Base(src))
+	}
+
+	if !srcInfo.IsDir() {
+		return copyFile(srcFS, src, srcInfo, destFS, dest, opts, summary)
+	}
+
+	// directory attributes must be applied after copying own files
+	type dirEntry struct {
+		path string
+		info os.FileInfo
+	}
+	var dirs []dirEntry
+
+	err = srcFS.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("cannot access a file %s. %v", p, err)
+		}
+		rel, err := srcFS.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := destFS.Join(dest, rel)
+
+		if rel != "." && !opts.matches(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			_, statErr := destFS.Stat(target)
+			if err := destFS.MkdirAll(target); err != nil {
+				return fmt.Errorf("cannot create a directory %s:%s. %v", destFS.Name(), target, err)
+			}
+			summary.Dirs++
+			// keep attributes of existing directories unless preserving
+			if opts.Preserve || os.IsNotExist(statErr) {
+				dirs = append(dirs, dirEntry{target, info})
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			fmt.Printf("> skip a non regular file %s:%s\n", srcFS.Name(), p)
+			return nil
+		}
+		return copyFile(srcFS, p, info, destFS, target, opts, summary)
 	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := applyAttributes(destFS, dirs[i].path, dirs[i].info, opts, summary); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func downloadFiles(src, dest string, client *sftp.Client) error {
+// copyFile copy a single file from srcFS to destFS.
+func copyFile(srcFS fileSystem, src string, srcInfo os.FileInfo, destFS fileSystem, dest string, opts copyOptions, summary *transferSummary) error {
+	r, err := srcFS.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := destFS.Create(dest)
+	if err != nil {
+		return fmt.Errorf("cannot create a file %s:%s. %v", destFS.Name(), dest, err)
+	}
+	written, err := io.Copy(w, r)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy %s:%s to %s:%s. %v", srcFS.Name(), src, destFS.Name(), dest, err)
+	}
+	fmt.Printf("%s:%s -> %s:%s (%d bytes)\n", srcFS.Name(), src, destFS.Name(), dest, written)
+
+	summary.Files++
+	summary.Bytes += written
+
+	if opts.Checksum {
+		// checksums are computed at both ends so corruption in transit is detected
+		srcSum, err := srcFS.Checksum(src)
+		if err != nil {
+			return fmt.Errorf("cannot compute checksum of %s:%s. %v", srcFS.Name(), src, err)
+		}
+		destSum, err := destFS.Checksum(dest)
+		if err != nil {
+			return fmt.Errorf("cannot compute checksum of %s:%s. %v", destFS.Name(), dest, err)
+		}
+		if srcSum != destSum {
+			summary.Mismatches = append(summary.Mismatches, destFS.Name()+":"+dest)
+			return fmt.Errorf("checksum mismatch %s:%s(%s) and %s:%s(%s)",
+				srcFS.Name(), src, srcSum, destFS.Name(), dest, destSum)
+		}
+		summary.Verified++
+	}
+	return applyAttributes(destFS, dest, srcInfo, opts, summary)
+}
+
+// applyAttributes set attributes of given file info to path.
+// If not preserving, only mode masked by umask of fs is applied like scp.
+func applyAttributes(fs fileSystem, p string, info os.FileInfo, opts copyOptions, summary *transferSummary) error {
+	if !opts.Preserve {
+		mode := info.Mode().Perm() &^ fs.Umask()
+		if err := fs.Chmod(p, mode); err != nil {
+			return fmt.Errorf("cannot change mode of %s:%s. %v", fs.Name(), p, err)
+		}
+		return nil
+	}
+
+	if err := fs.Chmod(p, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("cannot change mode of %s:%s. %v", fs.Name(), p, err)
+	}
+	if err := fs.Chtimes(p, accessTime(info), info.ModTime()); err != nil {
+		return fmt.Errorf("cannot change times of %s:%s. %v", fs.Name(), p, err)
+	}
+	// ownership can be changed only by privileged users, so just count failures.
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return nil
+	}
+	if destInfo, err := fs.Stat(p); err == nil {
+		if destUID, destGID, ok := fileOwner(destInfo); ok && destUID == uid && destGID == gid {
+			return nil
+		}
+	}
+	if err := fs.Chown(p, uid, gid); err != nil {
+		summary.OwnerFailures++
+	}
 	return nil
 }
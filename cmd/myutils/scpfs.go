@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/sftp"
+	"github.com/zacscoding/myutils/remote"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultUmask is used if cannot read umask of a file system
+const defaultUmask os.FileMode = 0022
+
+// fileSystem is a file system used as source or destination of scp.
+type fileSystem interface {
+	// Name returns a display name of this file system i.e "local" or hostname
+	Name() string
+	Stat(p string) (os.FileInfo, error)
+	Open(p string) (io.ReadCloser, error)
+	Create(p string) (io.WriteCloser, error)
+	MkdirAll(p string) error
+	Chmod(p string, mode os.FileMode) error
+	Chtimes(p string, atime, mtime time.Time) error
+	Chown(p string, uid, gid int) error
+	// Umask returns a file mode creation mask of this file system
+	Umask() os.FileMode
+	Walk(root string, walkFn filepath.WalkFunc) error
+	// Checksum returns a hex encoded SHA-256 of given file
+	Checksum(p string) (string, error)
+	// Glob returns the names of all files matching pattern
+	Glob(pattern string) ([]string, error)
+	// Base returns the last element of given path
+	Base(p string) string
+	// Rel returns a slash separated relative path of target from base
+	Rel(base, target string) (string, error)
+	// Join joins a path and slash separated relative path
+	Join(p, rel string) string
+}
+
+// localFS is a fileSystem of local machine.
+type localFS struct{}
+
+func (localFS) Name() string {
+	return "local"
+}
+
+func (localFS) Stat(p string) (os.FileInfo, error) {
+	return os.Stat(p)
+}
+
+func (localFS) Open(p string) (io.ReadCloser, error) {
+	return os.Open(p)
+}
+
+func (localFS) Create(p string) (io.WriteCloser, error) {
+	return os.Create(p)
+}
+
+func (localFS) MkdirAll(p string) error {
+	return os.MkdirAll(p, 0755)
+}
+
+func (localFS) Chmod(p string, mode os.FileMode) error {
+	return os.Chmod(p, mode)
+}
+
+func (localFS) Chtimes(p string, atime, mtime time.Time) error {
+	return os.Chtimes(p, atime, mtime)
+}
+
+func (localFS) Chown(p string, uid, gid int) error {
+	return os.Chown(p, uid, gid)
+}
+
+func (localFS) Umask() os.FileMode {
+	return localUmask()
+}
+
+func (localFS) Walk(root string, walkFn filepath.WalkFunc) error {
+	return filepath.Walk(root, walkFn)
+}
+
+func (l localFS) Checksum(p string) (string, error) {
+	return readChecksum(l, p)
+}
+
+func (localFS) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+func (localFS) Base(p string) string {
+	return filepath.Base(p)
+}
+
+func (localFS) Rel(base, target string) (string, error) {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func (localFS) Join(p, rel string) string {
+	return filepath.Join(p, filepath.FromSlash(rel))
+}
+
+// remoteFS is a fileSystem of remote host over sftp.
+type remoteFS struct {
+	name   string
+	conn   *remote.Client
+	client *sftp.Client
+
+	umaskOnce sync.Once
+	umask     os.FileMode
+}
+
+// newRemoteFS returns a new remoteFS given ssh and sftp clients.
+func newRemoteFS(name string, conn *remote.Client, client *sftp.Client) *remoteFS {
+	return &remoteFS{
+		name:   name,
+		conn:   conn,
+		client: client,
+	}
+}
+
+func (r *remoteFS) Name() string {
+	return r.name
+}
+
+func (r *remoteFS) Stat(p string) (os.FileInfo, error) {
+	return r.client.Stat(p)
+}
+
+func (r *remoteFS) Open(p string) (io.ReadCloser, error) {
+	return r.client.Open(p)
+}
+
+func (r *remoteFS) Create(p string) (io.WriteCloser, error) {
+	return r.client.Create(p)
+}
+
+func (r *remoteFS) MkdirAll(p string) error {
+	return r.client.MkdirAll(p)
+}
+
+func (r *remoteFS) Chmod(p string, mode os.FileMode) error {
+	return r.client.Chmod(p, mode)
+}
+
+func (r *remoteFS) Chtimes(p string, atime, mtime time.Time) error {
+	return r.client.Chtimes(p, atime, mtime)
+}
+
+func (r *remoteFS) Chown(p string, uid, gid int) error {
+	return r.client.Chown(p, uid, gid)
+}
+
+// Umask returns a umask of login shell in remote host.
+func (r *remoteFS) Umask() os.FileMode {
+	r.umaskOnce.Do(func() {
+		r.umask = defaultUmask
+		session, err := r.conn.NewSession()
+		if err != nil {
+			return
+		}
+		defer session.Close()
+
+		out, err := session.Output("umask")
+		if err != nil {
+			return
+		}
+		mask, err := strconv.ParseUint(strings.TrimSpace(string(out)), 8, 32)
+		if err != nil {
+			return
+		}
+		r.umask = os.FileMode(mask) & os.ModePerm
+	})
+	return r.umask
+}
+
+func (r *remoteFS) Walk(root string, walkFn filepath.WalkFunc) error {
+	walker := r.client.Walk(root)
+	for walker.Step() {
+		err := walkFn(walker.Path(), walker.Stat(), walker.Err())
+		if err == filepath.SkipDir {
+			if walker.Stat() != nil && walker.Stat().IsDir() {
+				walker.SkipDir()
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checksum returns a SHA-256 computed by sha256sum in remote host.
+// If cannot execute sha256sum, computes it with reading the file via sftp.
+func (r *remoteFS) Checksum(p string) (string, error) {
+	session, err := r.conn.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	out, err := session.Output("sha256sum " + shellQuote(p))
+	if err == nil {
+		if fields := strings.Fields(string(out)); len(fields) != 0 && len(fields[0]) == sha256.Size*2 {
+			return fields[0], nil
+		}
+	}
+	return readChecksum(r, p)
+}
+
+func (r *remoteFS) Glob(pattern string) ([]string, error) {
+	return r.client.Glob(pattern)
+}
+
+func (r *remoteFS) Base(p string) string {
+	return path.Base(p)
+}
+
+func (r *remoteFS) Rel(base, target string) (string, error) {
+	base, target = path.Clean(base), path.Clean(target)
+	if base == target {
+		return ".", nil
+	}
+	prefix := strings.TrimSuffix(base, "/") + "/"
+	if !strings.HasPrefix(target, prefix) {
+		return "", fmt.Errorf("Rel: can't make %s relative to %s", target, base)
+	}
+	return strings.TrimPrefix(target, prefix), nil
+}
+
+func (r *remoteFS) Join(p, rel string) string {
+	return path.Join(p, rel)
+}
+
+// readChecksum returns a hex encoded SHA-256 with reading given file in fs.
+func readChecksum(fs fileSystem, p string) (string, error) {
+	f, err := fs.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// fileOwner returns uid and gid of given file info if exist.
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		return int(stat.UID), int(stat.GID), true
+	}
+	return localFileOwner(info)
+}
+
+// accessTime returns a access time of given file info if exist, otherwise modification time.
+func accessTime(info os.FileInfo) time.Time {
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		return time.Unix(int64(stat.Atime), 0)
+	}
+	if atime, ok := localAccessTime(info); ok {
+		return atime
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// localAccessTime always returns false.
+func localAccessTime(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
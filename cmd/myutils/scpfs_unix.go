@@ -0,0 +1,48 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// processUmask is a umask of current process read once at startup,
+// because reading it with syscall.Umask changes it for a moment.
+var processUmask = readUmask()
+
+// localUmask returns a umask of current process.
+func localUmask() os.FileMode {
+	return processUmask
+}
+
+// readUmask returns a umask in /proc/self/status if exist.
+// Otherwise sets and restores the umask before other goroutines are started.
+func readUmask() os.FileMode {
+	if status, err := ioutil.ReadFile("/proc/self/status"); err == nil {
+		for _, line := range strings.Split(string(status), "\n") {
+			if !strings.HasPrefix(line, "Umask:") {
+				continue
+			}
+			if mask, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "Umask:")), 8, 32); err == nil {
+				return os.FileMode(mask) & os.ModePerm
+			}
+		}
+	}
+	mask := syscall.Umask(0)
+	syscall.Umask(mask)
+	return os.FileMode(mask) & os.ModePerm
+}
+
+// localFileOwner returns uid and gid of given local file info.
+func localFileOwner(info os.FileInfo) (int, int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// localUmask returns a default umask because windows doesn't have umask.
+func localUmask() os.FileMode {
+	return 0
+}
+
+// localFileOwner always returns false because windows doesn't have uid and gid.
+func localFileOwner(info os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
+
+// localAccessTime always returns false.
+func localAccessTime(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
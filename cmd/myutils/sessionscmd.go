@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/zacscoding/myutils/cast"
+	"github.com/zacscoding/myutils/utils"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sessionFileExt    = ".cast"
+	sessionTimeLayout = "20060102-150405"
+)
+
+var (
+	sessionsCommand = cli.Command{
+		Action:   ShowSubCommand,
+		Name:     "sessions",
+		Usage:    "manage recorded shell sessions such as list | play | export",
+		Category: "SSH COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List recorded sessions",
+				Action: listSessions,
+			},
+			{
+				Name:      "play",
+				Usage:     "Replay a recorded session",
+				Action:    playSession,
+				ArgsUsage: "[session name]",
+				Flags: []cli.Flag{
+					utils.PlaySpeedFlag,
+					utils.PlayMaxIdleFlag,
+				},
+			},
+			{
+				Name:      "export",
+				Usage:     "Export a recorded session to a file",
+				Action:    exportSession,
+				ArgsUsage: "[session name]",
+				Flags: []cli.Flag{
+					utils.PathFlag,
+					utils.ExportFormatFlag,
+				},
+			},
+		},
+	}
+)
+
+// createSessionFile creates a new asciicast file in sessions directory given host name.
+func createSessionFile(hostName string) (*os.File, error) {
+	dir, err := utils.GetSessionsPath()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	name := hostName + "_" + time.Now().Format(sessionTimeLayout) + sessionFileExt
+	return os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+}
+
+// listSessions display all recorded sessions.
+func listSessions(ctx *cli.Context) error {
+	dir, err := utils.GetSessionsPath()
+	if err != nil {
+		return err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+sessionFileExt))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		log.Printf("> empty recorded sessions in %s", dir)
+		return nil
+	}
+	sort.Strings(files)
+
+	for i, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), sessionFileExt)
+		header, events, err := readSession(file)
+		if err != nil {
+			log.Printf("%v -> %s (cannot read: %v)\n", i+1, name, err)
+			continue
+		}
+		log.Printf("%v -> %s, host : %s, started : %s, duration : %v\n", i+1, name, header.Title,
+			time.Unix(header.Timestamp, 0).Format(time.RFC3339), cast.Duration(events).Round(time.Second))
+	}
+	return nil
+}
+
+// playSession replay a recorded session to console.
+func playSession(ctx *cli.Context) error {
+	file, err := getSessionFile(ctx)
+	if err != nil {
+		return err
+	}
+	_, events, err := readSession(file)
+	if err != nil {
+		return err
+	}
+	return cast.Play(os.Stdout, events, ctx.Float64(utils.PlaySpeedFlag.Name), ctx.Duration(utils.PlayMaxIdleFlag.Name))
+}
+
+// exportSession export a recorded session as asciicast or plain text.
+func exportSession(ctx *cli.Context) error {
+	file, err := getSessionFile(ctx)
+	if err != nil {
+		return err
+	}
+	path := ctx.String(utils.PathFlag.Name)
+	if path == "" {
+		return errors.New(`path must not be ""`)
+	}
+
+	format := ctx.String(utils.ExportFormatFlag.Name)
+	ext := sessionFileExt
+	if format == "text" {
+		ext = ".txt"
+	} else if format != "cast" {
+		return fmt.Errorf("unsupported format : %s", format)
+	}
+	if fi, err := os.Stat(path); err == nil {
+		if !fi.IsDir() {
+			return errors.New("already exist file :" + path)
+		}
+		path = filepath.Join(path, strings.TrimSuffix(filepath.Base(file), sessionFileExt)+ext)
+	}
+
+	var data []byte
+	if format == "cast" {
+		data, err = ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+	} else {
+		_, events, err := readSession(file)
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		for _, e := range events {
+			if e.Type == cast.EventOutput {
+				b.WriteString(e.Data)
+			}
+		}
+		data = []byte(b.String())
+	}
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	log.Println("success to export a session. destination :", path)
+	return nil
+}
+
+// getSessionFile returns a path of recorded session given first argument.
+func getSessionFile(ctx *cli.Context) (string, error) {
+	if ctx.NArg() != 1 {
+		return "", errors.New("required args [session name]")
+	}
+	dir, err := utils.GetSessionsPath()
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, strings.TrimSuffix(ctx.Args()[0], sessionFileExt)+sessionFileExt)
+	if _, err := os.Stat(file); err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// readSession returns a header and events of given asciicast file.
+func readSession(file string) (*cast.Header, []cast.Event, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return cast.Read(f)
+}
@@ -5,12 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"github.com/urfave/cli"
+	"github.com/zacscoding/myutils/cast"
 	"github.com/zacscoding/myutils/host"
 	"github.com/zacscoding/myutils/remote"
 	"github.com/zacscoding/myutils/types"
+	"github.com/zacscoding/myutils/utils"
+	"golang.org/x/crypto/ssh"
 	"log"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -24,31 +28,64 @@ var (
 				Name:      "shell",
 				Usage:     "open remote shell",
 				Action:    openRemoteShell,
-				ArgsUsage: "[host name]",
+				ArgsUsage: "[host name] [-- command...]",
+				Flags: []cli.Flag{
+					utils.RecordFlag,
+					utils.ForwardAgentFlag,
+					utils.EscapeCharFlag,
+				},
+			},
+			{
+				Name:      "cluster",
+				Usage:     "open remote shells on hosts matched by patterns and send keystrokes to all of them",
+				Action:    openClusterShell,
+				ArgsUsage: "[host name patterns e.g. web-*]",
+				Flags: []cli.Flag{
+					utils.ForwardAgentFlag,
+					utils.EscapeCharFlag,
+				},
 			},
 			{
 				Name:      "command",
 				Usage:     "execute given command to a host",
 				Action:    executeCommands,
 				ArgsUsage: "[comma separated list of host name]",
+				Flags: []cli.Flag{
+					utils.ForwardAgentFlag,
+				},
 			},
 		},
 	}
 )
 
-// openRemoteShell start to open remote shell given cli context
+// openRemoteShell start to open remote shell or a command after "--" given cli context.
+// Exit status of the remote shell or command is propagated as exit code.
 func openRemoteShell(ctx *cli.Context) error {
-	if ctx.NArg() != 1 {
+	if ctx.NArg() == 0 {
 		return errors.New(fmt.Sprintf("invalid arguments : %v", ctx.Args()))
 	}
+	commandArgs := ctx.Args()[1:]
+	if len(commandArgs) != 0 && commandArgs[0] == "--" {
+		commandArgs = commandArgs[1:]
+	}
 
-	h, err := host.GetHost(app.db, ctx.Args()[0])
+	escapeChar, err := parseEscapeChar(ctx.String("escape-char"))
 	if err != nil {
 		return err
 	}
-	// close database
-	app.db.Close()
 
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	h, err := host.GetHost(store, ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	// release local store during the shell
+	app.closeStore()
+
+	h.ForwardAgent = resolveForwardAgent(ctx, h)
 	conn, err := remote.CreateSSHClient(h)
 	if err != nil {
 		log.Fatal(err)
@@ -56,7 +93,73 @@ func openRemoteShell(ctx *cli.Context) error {
 	}
 	defer conn.Close()
 
-	return remote.OpenRemoteShell(conn)
+	opts := &remote.ShellOptions{
+		ForwardAgent: h.ForwardAgent,
+		Command:      strings.Join(commandArgs, " "),
+		EscapeChar:   escapeChar,
+	}
+	if ctx.Bool(utils.RecordFlag.Name) {
+		f, err := createSessionFile(h.Name)
+		if err != nil {
+			return err
+		}
+		recorder := cast.NewRecorder(f, h.Name)
+		defer func() {
+			f.Close()
+			if err := recorder.Err(); err != nil {
+				log.Printf("recording is stopped by an error. %v\n", err)
+			}
+			log.Println("session is recorded :", f.Name())
+		}()
+		opts.Recorder = recorder
+	}
+
+	err = remote.OpenRemoteShell(conn, opts)
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		return cli.NewExitError("", exitErr.ExitStatus())
+	}
+	return err
+}
+
+// openClusterShell opens shells on hosts which names are matched by glob patterns given cli context.
+func openClusterShell(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errors.New(fmt.Sprintf("invalid arguments : %v", ctx.Args()))
+	}
+	escapeChar, err := parseEscapeChar(ctx.String("escape-char"))
+	if err != nil {
+		return err
+	}
+
+	hosts, err := matchHosts(ctx.Args())
+	if err != nil {
+		return err
+	}
+	// release local store during the shell
+	app.closeStore()
+
+	for _, h := range hosts {
+		h.ForwardAgent = resolveForwardAgent(ctx, h)
+	}
+	return remote.OpenClusterShell(hosts, &remote.ClusterOptions{
+		EscapeChar: escapeChar,
+	})
+}
+
+// matchHosts returns hosts which names are matched by any of given glob patterns.
+func matchHosts(patterns []string) ([]*types.Host, error) {
+	store, err := app.store()
+	if err != nil {
+		return nil, err
+	}
+	matched, _, err := host.FindHosts(store, &host.Query{Names: patterns})
+	if err != nil {
+		return nil, err
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no hosts matched by %v", patterns)
+	}
+	return matched, nil
 }
 
 // executeCommands execute given command to hosts
@@ -68,15 +171,21 @@ func executeCommands(ctx *cli.Context) error {
 	hostNames := strings.Split(ctx.Args()[0], ",")
 	command := ctx.Args()[1]
 
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
 	var hosts []*types.Host
 	for _, hostName := range hostNames {
-		h, err := host.GetHost(app.db, hostName)
+		h, err := host.GetHost(store, hostName)
 		if err != nil {
 			fmt.Println("failed to find a host. name :", hostName)
 			continue
 		}
+		h.ForwardAgent = resolveForwardAgent(ctx, h)
 		hosts = append(hosts, h)
 	}
+	app.closeStore()
 
 	commandGen := func(h *types.Host) string {
 		return command
@@ -84,26 +193,49 @@ func executeCommands(ctx *cli.Context) error {
 
 	mux := &sync.Mutex{}
 	var successes, failures []string
+	start := time.Now()
+	a := &types.Audit{
+		Time:    start,
+		Action:  "ssh command",
+		Command: command,
+	}
 
 	resultHandler := func(result remote.HostCmdResult) {
+		auditResult := &types.AuditResult{
+			Host:     result.Host.Name,
+			Duration: result.Duration,
+		}
+		err := result.Err
+		if err == nil {
+			err = result.Result.Error
+		}
+		if err != nil {
+			auditResult.ExitStatus = -1
+			if exitErr, ok := err.(*ssh.ExitError); ok {
+				auditResult.ExitStatus = exitErr.ExitStatus()
+			}
+			auditResult.Error = err.Error()
+		}
+
 		var res string
-		if result.Err != nil {
-			mux.Lock()
+		mux.Lock()
+		a.Hosts = append(a.Hosts, auditResult)
+		if err != nil {
 			failures = append(failures, result.Host.Name)
-			mux.Unlock()
 			res = "fail"
 		} else {
-			mux.Lock()
 			successes = append(successes, result.Host.Name)
-			mux.Unlock()
 			res = "success"
 		}
+		mux.Unlock()
+
 		var out bytes.Buffer
 		out.WriteString("// ------------------------------------------------\n")
 		out.WriteString(fmt.Sprintf("host : %s, result : %s, command : %s\n", result.Host.Name, res, result.Command))
-		if result.Err != nil {
-			out.WriteString(fmt.Sprintf("> error :%v\n", result.Err))
-		} else {
+		if err != nil {
+			out.WriteString(fmt.Sprintf("> error :%v\n", err))
+		}
+		if result.Result != nil {
 			out.WriteString(fmt.Sprintf("> standard output:\n%s\n", result.Result.StdOut))
 			out.WriteString(fmt.Sprintf("> standard error:\n%s\n", result.Result.StdErr))
 		}
@@ -112,5 +244,32 @@ func executeCommands(ctx *cli.Context) error {
 	}
 	remote.ExecutesCommand(hosts, commandGen, resultHandler)
 	fmt.Printf(">> Success : %v, Fail : %v\n", successes, failures)
+
+	a.Duration = time.Since(start)
+	recordAudit(a)
 	return nil
 }
+
+// parseEscapeChar returns an escape character given a flag value or 0 if "none".
+func parseEscapeChar(value string) (byte, error) {
+	if value == "none" {
+		return 0, nil
+	}
+	if len(value) != 1 {
+		return 0, fmt.Errorf("invalid escape character : %s", value)
+	}
+	return value[0], nil
+}
+
+// resolveForwardAgent returns true if forwarding agent to given host is enabled by flag or host.
+// Warns if the host is not trusted for agent forwarding.
+func resolveForwardAgent(ctx *cli.Context, h *types.Host) bool {
+	if !ctx.Bool("forward-agent") {
+		return h.ForwardAgent
+	}
+	if !h.ForwardAgent {
+		log.Printf("[WARN] host %s is not trusted for agent forwarding. "+
+			"users who can access the agent socket on the host can use your keys.", h.Name)
+	}
+	return true
+}
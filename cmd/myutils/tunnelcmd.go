@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"github.com/zacscoding/myutils/host"
+	"github.com/zacscoding/myutils/remote"
+	"github.com/zacscoding/myutils/tunnel"
+	"github.com/zacscoding/myutils/types"
+	"github.com/zacscoding/myutils/utils"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	forwardFlags = []cli.Flag{
+		utils.LocalForwardFlag,
+		utils.RemoteForwardFlag,
+		utils.DynamicForwardFlag,
+	}
+
+	tunnelCommand = cli.Command{
+		Action:    openTunnels,
+		Name:      "tunnel",
+		Usage:     "forward ports over ssh [-L | -R | -D] or manage named tunnels in background",
+		Category:  "SSH COMMANDS",
+		ArgsUsage: "[-L | -R | -D forward ...] [host name]",
+		Flags:     append(forwardFlags, utils.SaveForwardsFlag),
+		Subcommands: []cli.Command{
+			{
+				Name:      "add",
+				Usage:     "Adds a named tunnel",
+				Action:    addTunnel,
+				ArgsUsage: "[tunnel name] [host name]",
+				Flags:     forwardFlags,
+			},
+			{
+				Name:      "remove",
+				Usage:     "Remove a named tunnel",
+				Action:    removeTunnel,
+				ArgsUsage: "[tunnel name]",
+			},
+			{
+				Name:   "list",
+				Usage:  "List named tunnels",
+				Action: listTunnels,
+			},
+			{
+				Name:      "start",
+				Usage:     "Start named tunnels in background daemon (all tunnels if empty)",
+				Action:    startTunnels,
+				ArgsUsage: "[tunnel names...]",
+			},
+			{
+				Name:      "stop",
+				Usage:     "Stop named tunnels (stop the daemon if empty)",
+				Action:    stopTunnels,
+				ArgsUsage: "[tunnel names...]",
+			},
+			{
+				Name:   "status",
+				Usage:  "Show status of tunnels in background daemon",
+				Action: showTunnelStatus,
+			},
+			{
+				Name:   "daemon",
+				Usage:  "Run tunnel daemon in foreground",
+				Action: runTunnelDaemon,
+				Hidden: true,
+			},
+		},
+	}
+)
+
+// openTunnels start to forward given ports or saved forwards of a host until interrupted.
+func openTunnels(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return cli.ShowSubcommandHelp(ctx)
+	}
+	if ctx.NArg() != 1 {
+		return errors.New(fmt.Sprintf("invalid arguments : %v. forward flags must be placed before host name", ctx.Args()))
+	}
+
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	h, err := host.GetHost(store, ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	forwards, err := parseForwards(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(forwards) == 0 {
+		forwards = h.Forwards
+	} else if ctx.Bool(utils.SaveForwardsFlag.Name) {
+		h.Forwards = forwards
+		if err := host.UpdateHost(store, h); err != nil {
+			return err
+		}
+	}
+	if len(forwards) == 0 {
+		return errors.New("empty forwards. use -L, -R or -D or save forwards to the host")
+	}
+	// release local store while forwarding
+	app.closeStore()
+
+	// remote forwards require an own connection
+	conn, err := remote.DialSSHClient(h)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, f := range forwards {
+		listener, err := remote.StartForward(conn.Client, f)
+		if err != nil {
+			return fmt.Errorf("failed to start forward %v. %v", f, err)
+		}
+		defer listener.Close()
+		log.Printf("> forwarding %v via %s\n", f, h.Name)
+	}
+
+	// wait until interrupted or disconnected
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	disconnected := make(chan error, 1)
+	go func() {
+		disconnected <- conn.Wait()
+	}()
+
+	select {
+	case sig := <-sigs:
+		log.Printf("> stop forwarding by %v\n", sig)
+		return nil
+	case err := <-disconnected:
+		return fmt.Errorf("disconnected from %s. %v", h.Name, err)
+	}
+}
+
+// parseForwards returns forwards given -L, -R and -D flags.
+func parseForwards(ctx *cli.Context) ([]*types.Forward, error) {
+	var forwards []*types.Forward
+	flags := []struct {
+		name        string
+		forwardType string
+	}{
+		{utils.LocalForwardFlag.Name, types.ForwardLocal},
+		{utils.RemoteForwardFlag.Name, types.ForwardRemote},
+		{utils.DynamicForwardFlag.Name, types.ForwardDynamic},
+	}
+	for _, flag := range flags {
+		for _, spec := range ctx.StringSlice(flag.name) {
+			f, err := remote.ParseForward(flag.forwardType, spec)
+			if err != nil {
+				return nil, err
+			}
+			forwards = append(forwards, f)
+		}
+	}
+	return forwards, nil
+}
+
+// addTunnel save a named tunnel with given forwards.
+func addTunnel(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return errors.New("required args [tunnel name] [host name]")
+	}
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	if _, err := host.GetHost(store, ctx.Args()[1]); err != nil {
+		return fmt.Errorf("cannot find a host %s. %v", ctx.Args()[1], err)
+	}
+	forwards, err := parseForwards(ctx)
+	if err != nil {
+		return err
+	}
+	return tunnel.AddTunnel(store, &types.Tunnel{
+		Name:     ctx.Args()[0],
+		Host:     ctx.Args()[1],
+		Forwards: forwards,
+	})
+}
+
+// removeTunnel delete a named tunnel.
+func removeTunnel(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("required args [tunnel name]")
+	}
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	return tunnel.DeleteTunnel(store, ctx.Args()[0])
+}
+
+// listTunnels display all named tunnels.
+func listTunnels(ctx *cli.Context) error {
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	tunnels, err := tunnel.GetTunnels(store)
+	if err != nil {
+		return err
+	}
+	if len(tunnels) == 0 {
+		log.Printf("> empty tunnels in local store")
+		return nil
+	}
+	for i, t := range tunnels {
+		log.Printf("%v -> %s, host : %s, forwards : %v\n", i+1, t.Name, t.Host, t.Forwards)
+	}
+	return nil
+}
+
+// startTunnels start named tunnels in daemon. The daemon is started if not running.
+func startTunnels(ctx *cli.Context) error {
+	store, err := app.store()
+	if err != nil {
+		return err
+	}
+	var tunnels []*types.Tunnel
+	if ctx.NArg() == 0 {
+		tunnels, err = tunnel.GetTunnels(store)
+	} else {
+		for _, name := range ctx.Args() {
+			t, err := tunnel.GetTunnel(store, name)
+			if err != nil {
+				return err
+			}
+			tunnels = append(tunnels, t)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(tunnels) == 0 {
+		return errors.New("empty tunnels to start")
+	}
+
+	req := &tunnel.Request{Command: tunnel.CommandStart}
+	for _, t := range tunnels {
+		h, err := host.GetHost(store, t.Host)
+		if err != nil {
+			return fmt.Errorf("cannot find a host %s of tunnel %s. %v", t.Host, t.Name, err)
+		}
+		req.Tunnels = append(req.Tunnels, &tunnel.TunnelSpec{Tunnel: t, Host: h})
+	}
+
+	socketPath, err := utils.GetTunnelSocketPath()
+	if err != nil {
+		return err
+	}
+	app.closeStore()
+	if err := ensureTunnelDaemon(socketPath); err != nil {
+		return err
+	}
+	return sendTunnelRequest(socketPath, req)
+}
+
+// stopTunnels stop named tunnels in daemon or stop the daemon if empty names.
+func stopTunnels(ctx *cli.Context) error {
+	socketPath, err := utils.GetTunnelSocketPath()
+	if err != nil {
+		return err
+	}
+	if ctx.NArg() == 0 {
+		return sendTunnelRequest(socketPath, &tunnel.Request{Command: tunnel.CommandShutdown})
+	}
+	return sendTunnelRequest(socketPath, &tunnel.Request{Command: tunnel.CommandStop, Names: ctx.Args()})
+}
+
+// showTunnelStatus display statuses of tunnels in daemon.
+func showTunnelStatus(ctx *cli.Context) error {
+	socketPath, err := utils.GetTunnelSocketPath()
+	if err != nil {
+		return err
+	}
+	return sendTunnelRequest(socketPath, &tunnel.Request{Command: tunnel.CommandStatus})
+}
+
+// runTunnelDaemon runs tunnel daemon until shutdown or terminated.
+func runTunnelDaemon(ctx *cli.Context) error {
+	socketPath, err := utils.GetTunnelSocketPath()
+	if err != nil {
+		return err
+	}
+	manager := tunnel.NewManager()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		log.Printf("tunnel daemon is terminated by %v\n", sig)
+		manager.StopAll()
+		_ = os.Remove(socketPath)
+		os.Exit(0)
+	}()
+	return tunnel.Serve(socketPath, manager)
+}
+
+// ensureTunnelDaemon starts tunnel daemon in background if not running.
+func ensureTunnelDaemon(socketPath string) error {
+	logPath, err := utils.GetTunnelLogPath()
+	if err != nil {
+		return err
+	}
+	return ensureDaemon("tunnel", logPath, func() bool {
+		_, err := tunnel.Send(socketPath, &tunnel.Request{Command: tunnel.CommandStatus})
+		return err == nil
+	})
+}
+
+// sendTunnelRequest sends a request to tunnel daemon and display the response.
+func sendTunnelRequest(socketPath string, req *tunnel.Request) error {
+	res, err := tunnel.Send(socketPath, req)
+	if err != nil {
+		return fmt.Errorf("cannot connect to tunnel daemon. %v", err)
+	}
+	if req.Command == tunnel.CommandShutdown {
+		log.Println("> tunnel daemon is stopped")
+		return nil
+	}
+
+	if len(res.Statuses) == 0 {
+		log.Printf("> empty running tunnels")
+	}
+	for i, status := range res.Statuses {
+		line := fmt.Sprintf("%v -> %s, host : %s, state : %s (since %s), retries : %d, forwards : %v",
+			i+1, status.Name, status.Host, status.State, status.Since.Format(time.RFC3339), status.Retries, status.Forwards)
+		if status.LastError != "" {
+			line += ", last error : " + status.LastError
+		}
+		log.Println(line)
+	}
+	if len(res.Errors) != 0 {
+		return fmt.Errorf("%s", strings.Join(res.Errors, "\n"))
+	}
+	return nil
+}
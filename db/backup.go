@@ -0,0 +1,190 @@
+package db
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	backupFormatVersion = 1
+	backupManifestName  = "manifest.json"
+	backupDataName      = "data.jsonl"
+)
+
+// Manifest describes entries in a backup archive.
+type Manifest struct {
+	FormatVersion int       `json:"formatVersion"`
+	CreatedAt     time.Time `json:"createdAt"`
+	Entries       int       `json:"entries"`
+	// SHA256 is a hex encoded checksum of the data file
+	SHA256 string `json:"sha256"`
+}
+
+// backupEntry is a key/value pair in data file of a backup archive.
+type backupEntry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Backup writes all key/value pairs of a reader i.e snapshot to w as tar.gz archive
+// with a manifest including checksum of entries.
+func Backup(r Reader, w io.Writer) (*Manifest, error) {
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	itr := r.NewIteratorWithPrefix(nil)
+	defer itr.Release()
+
+	manifest := &Manifest{
+		FormatVersion: backupFormatVersion,
+		CreatedAt:     time.Now(),
+	}
+	for itr.Next() {
+		if err := encoder.Encode(&backupEntry{Key: itr.Key(), Value: itr.Value()}); err != nil {
+			return nil, err
+		}
+		manifest.Entries++
+	}
+	if err := itr.Error(); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data.Bytes())
+	manifest.SHA256 = hex.EncodeToString(sum[:])
+	encodedManifest, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	files := []struct {
+		name string
+		body []byte
+	}{
+		{backupManifestName, encodedManifest},
+		{backupDataName, data.Bytes()},
+	}
+	for _, f := range files {
+		header := &tar.Header{
+			Name:    f.name,
+			Mode:    0600,
+			Size:    int64(len(f.body)),
+			ModTime: manifest.CreatedAt,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// ReadBackup reads a backup archive and verifies entries with the manifest.
+// Returns the manifest and key/value pairs in the archive.
+func ReadBackup(r io.Reader) (*Manifest, map[string][]byte, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid backup archive. %v", err)
+	}
+	defer gr.Close()
+
+	var manifest *Manifest
+	var data []byte
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid backup archive. %v", err)
+		}
+		body, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch header.Name {
+		case backupManifestName:
+			if err := json.Unmarshal(body, &manifest); err != nil {
+				return nil, nil, fmt.Errorf("invalid manifest. %v", err)
+			}
+		case backupDataName:
+			data = body
+		}
+	}
+	if manifest == nil {
+		return nil, nil, errors.New("manifest is missing in backup archive")
+	}
+	if manifest.FormatVersion > backupFormatVersion {
+		return nil, nil, fmt.Errorf("unsupported backup format version %d", manifest.FormatVersion)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != manifest.SHA256 {
+		return nil, nil, errors.New("checksum mismatch. backup archive is corrupted")
+	}
+
+	entries := make(map[string][]byte)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		var e backupEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, nil, fmt.Errorf("invalid entry in backup archive. %v", err)
+		}
+		entries[string(e.Key)] = e.Value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(entries) != manifest.Entries {
+		return nil, nil, fmt.Errorf("expected %d entries but %d", manifest.Entries, len(entries))
+	}
+	return manifest, entries, nil
+}
+
+// Restore replaces all key/value pairs of a store with given entries atomically.
+func Restore(store Store, entries map[string][]byte) error {
+	snapshot, err := store.NewSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+
+	batch := store.NewBatch()
+	itr := snapshot.NewIteratorWithPrefix(nil)
+	for itr.Next() {
+		if _, ok := entries[string(itr.Key())]; !ok {
+			batch.Delete(itr.Key())
+		}
+	}
+	itr.Release()
+	if err := itr.Error(); err != nil {
+		return err
+	}
+	for k, v := range entries {
+		batch.Put([]byte(k), v)
+	}
+	return batch.Write()
+}
+
+// Compacter is implemented by stores which can compact underlying storage.
+type Compacter interface {
+	Compact() error
+}
@@ -0,0 +1,216 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// JSONStore is a store persisting all key/value pairs into a json file.
+// The whole file is loaded when opened and rewritten atomically on every change,
+// so it fits small data such as hosts and is easy to inspect or back up.
+// Values which are compact json are stored as json and others are stored as base64,
+// so every value is read back byte-for-byte.
+type JSONStore struct {
+	path   string
+	unlock func()
+
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewJSONStore returns a store of given json file. The file is created on first write if not exist.
+// The store locks path.lock file until closed and returns ErrBusy if locked by another process.
+func NewJSONStore(path string) (*JSONStore, error) {
+	if path == "" {
+		return nil, errors.New("invalid path")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	s := &JSONStore{
+		path:   path,
+		unlock: unlock,
+		data:   make(map[string][]byte),
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		unlock()
+		return nil, err
+	}
+	if len(b) != 0 {
+		var file jsonFile
+		if err := json.Unmarshal(b, &file); err != nil {
+			unlock()
+			return nil, err
+		}
+		for _, e := range file.Entries {
+			if e.Value != nil {
+				s.data[e.Key] = []byte(e.Value)
+			} else {
+				s.data[e.Key] = e.Bytes
+			}
+		}
+	}
+	log.Println("Open local database: ", path)
+	return s, nil
+}
+
+// Has returns true if its present in the store, otherwise false.
+func (s *JSONStore) Has(key []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.data[string(key)]
+	return ok, nil
+}
+
+// Get returns a value given key.
+func (s *JSONStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	val, ok := s.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyBytes(val), nil
+}
+
+// Put inserts the given value into the store.
+func (s *JSONStore) Put(key []byte, value []byte) error {
+	return s.apply([]batchOp{{key: string(key), value: copyBytes(value)}})
+}
+
+// Delete removes the key from the store.
+func (s *JSONStore) Delete(key []byte) error {
+	return s.apply([]batchOp{{key: string(key), delete: true}})
+}
+
+// NewIteratorWithPrefix returns the key space given prefix.
+// The iterator reads a snapshot of the store when created.
+func (s *JSONStore) NewIteratorWithPrefix(prefix []byte) Iterator {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return newSliceIterator(s.data, string(prefix))
+}
+
+// NewBatch returns a batch written to the file at once.
+func (s *JSONStore) NewBatch() Batch {
+	return &mapBatch{write: s.apply}
+}
+
+// NewSnapshot returns a copy of current key/value pairs.
+func (s *JSONStore) NewSnapshot() (Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return newMapSnapshot(s.data), nil
+}
+
+// Path returns the path to json file
+func (s *JSONStore) Path() string {
+	return s.path
+}
+
+// Close releases the lock of the file. Changes are already written.
+func (s *JSONStore) Close() {
+	s.unlock()
+}
+
+// apply applies operations to a copy of data and replaces the file with it.
+func (s *JSONStore) apply(ops []batchOp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := make(map[string][]byte, len(s.data))
+	for k, v := range s.data {
+		data[k] = v
+	}
+	applyBatch(data, ops)
+	if err := writeJSONFile(s.path, data); err != nil {
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+// jsonFile is a content of json store file.
+type jsonFile struct {
+	Entries []jsonEntry `json:"entries"`
+}
+
+// jsonEntry is a key/value pair with a json value or bytes.
+type jsonEntry struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Bytes []byte          `json:"bytes,omitempty"`
+}
+
+// writeJSONFile writes data sorted by keys with an entry per line to a temporary file and renames it to given path.
+func writeJSONFile(path string, data map[string][]byte) error {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	buf.WriteString("{\"entries\": [\n")
+	for i, k := range keys {
+		v := data[k]
+		entry := jsonEntry{Key: k, Bytes: v}
+		if isStoredAsIs(v) {
+			entry = jsonEntry{Key: k, Value: v}
+		}
+		encoded, err := json.Marshal(&entry)
+		if err != nil {
+			return err
+		}
+		buf.WriteString("  ")
+		buf.Write(encoded)
+		if i != len(keys)-1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("]}\n")
+	b := buf.Bytes()
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// isStoredAsIs returns true if a value is json which is encoded without any change
+// i.e without whitespaces or characters escaped by json encoder.
+func isStoredAsIs(v []byte) bool {
+	if len(v) == 0 || !json.Valid(v) {
+		return false
+	}
+	encoded, err := json.Marshal(json.RawMessage(v))
+	return err == nil && bytes.Equal(encoded, v)
+}
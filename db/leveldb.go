@@ -9,12 +9,13 @@ import (
 	"log"
 )
 
+// Database is a store backed by goleveldb.
 type Database struct {
 	db   *leveldb.DB
 	path string
 }
 
-// NewDatabase returns a new db
+// NewDatabase returns a new db or ErrBusy if the db is locked by another process
 func NewDatabase(path string, o *opt.Options) (*Database, error) {
 	if path == "" {
 		return nil, errors.New("invalid path")
@@ -28,9 +29,12 @@ func NewDatabase(path string, o *opt.Options) (*Database, error) {
 	db, err := leveldb.OpenFile(path, &opts)
 	if errors.IsCorrupted(err) {
 		db, err = leveldb.RecoverFile(path, &opts)
-		if err != nil {
-			return nil, err
-		}
+	}
+	if isLockError(err) {
+		return nil, ErrBusy
+	}
+	if err != nil {
+		return nil, err
 	}
 	log.Println("Open local database: ", path)
 
@@ -53,6 +57,9 @@ func (db *Database) Put(key []byte, value []byte) error {
 // Get returns a value given key.
 func (db *Database) Get(key []byte) ([]byte, error) {
 	val, err := db.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -70,20 +77,87 @@ func (db *Database) NewIteratorWithStart(start []byte) iterator.Iterator {
 }
 
 // NewIteratorWithPrefix returns the key space given prefix.
-func (db *Database) NewIteratorWithPrefix(p []byte) iterator.Iterator {
+func (db *Database) NewIteratorWithPrefix(p []byte) Iterator {
 	return db.db.NewIterator(util.BytesPrefix(p), nil)
 }
 
+// NewBatch returns a batch written to the store atomically.
+func (db *Database) NewBatch() Batch {
+	return &levelBatch{db: db.db, batch: new(leveldb.Batch)}
+}
+
 // Delete removes the key from the store.
 func (db *Database) Delete(key []byte) error {
 	return db.db.Delete(key, nil)
 }
 
+// NewSnapshot returns a point-in-time view of the database.
+func (db *Database) NewSnapshot() (Snapshot, error) {
+	snapshot, err := db.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &levelSnapshot{snapshot: snapshot}, nil
+}
+
+// Compact compacts the entire key range of the database.
+func (db *Database) Compact() error {
+	return db.db.CompactRange(util.Range{})
+}
+
 // Path returns the path to db directory
 func (db *Database) Path() string {
 	return db.path
 }
 
+// Close closes the database
 func (db *Database) Close() {
 	_ = db.db.Close()
 }
+
+// levelSnapshot is a snapshot of goleveldb
+type levelSnapshot struct {
+	snapshot *leveldb.Snapshot
+}
+
+func (s *levelSnapshot) Has(key []byte) (bool, error) {
+	return s.snapshot.Has(key, nil)
+}
+
+func (s *levelSnapshot) Get(key []byte) ([]byte, error) {
+	val, err := s.snapshot.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return val, err
+}
+
+func (s *levelSnapshot) NewIteratorWithPrefix(p []byte) Iterator {
+	return s.snapshot.NewIterator(util.BytesPrefix(p), nil)
+}
+
+func (s *levelSnapshot) Release() {
+	s.snapshot.Release()
+}
+
+// levelBatch is a batch of goleveldb
+type levelBatch struct {
+	db    *leveldb.DB
+	batch *leveldb.Batch
+}
+
+func (b *levelBatch) Put(key []byte, value []byte) {
+	b.batch.Put(key, value)
+}
+
+func (b *levelBatch) Delete(key []byte) {
+	b.batch.Delete(key)
+}
+
+func (b *levelBatch) Len() int {
+	return b.batch.Len()
+}
+
+func (b *levelBatch) Write() error {
+	return b.db.Write(b.batch, nil)
+}
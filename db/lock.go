@@ -0,0 +1,39 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const openRetryInterval = 100 * time.Millisecond
+
+// ErrBusy is returned if a store is locked by another process.
+var ErrBusy = errors.New("db: store is busy")
+
+// BusyError is returned by OpenWithTimeout if a store is still locked by another process after timeout.
+type BusyError struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("store busy: %s is used by another myutils process. tried for %v, retry later or increase --db-timeout",
+		e.Path, e.Timeout)
+}
+
+// OpenWithTimeout opens a store given backend and retries while the store is locked
+// by another process until timeout.
+func OpenWithTimeout(backend, path string, timeout time.Duration) (Store, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		store, err := Open(backend, path)
+		if err != ErrBusy {
+			return store, err
+		}
+		if time.Now().After(deadline) {
+			return nil, &BusyError{Path: path, Timeout: timeout}
+		}
+		time.Sleep(openRetryInterval)
+	}
+}
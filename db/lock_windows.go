@@ -0,0 +1,52 @@
+package db
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+// isLockError returns true if given error is returned because a file is locked by another process.
+func isLockError(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == errorSharingViolation || err == errorLockViolation
+}
+
+// lockFile locks a file of given path exclusively with LockFileEx and returns a function to release it.
+// The lock is released by the OS if the process dies. Returns ErrBusy if the file is locked by another process.
+func lockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	overlapped := new(syscall.Overlapped)
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately,
+		0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r == 0 {
+		f.Close()
+		if isLockError(err) {
+			return nil, ErrBusy
+		}
+		return nil, err
+	}
+	return func() {
+		_, _, _ = procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+		f.Close()
+	}, nil
+}
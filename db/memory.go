@@ -0,0 +1,219 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore is a store keeping key/value pairs in memory i.e for tests.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemoryStore returns a new empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: make(map[string][]byte)}
+}
+
+// Has returns true if its present in the store, otherwise false.
+func (s *MemoryStore) Has(key []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.data[string(key)]
+	return ok, nil
+}
+
+// Get returns a value given key.
+func (s *MemoryStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	val, ok := s.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyBytes(val), nil
+}
+
+// Put inserts the given value into the store.
+func (s *MemoryStore) Put(key []byte, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[string(key)] = copyBytes(value)
+	return nil
+}
+
+// Delete removes the key from the store.
+func (s *MemoryStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, string(key))
+	return nil
+}
+
+// NewIteratorWithPrefix returns the key space given prefix.
+// The iterator reads a snapshot of the store when created.
+func (s *MemoryStore) NewIteratorWithPrefix(prefix []byte) Iterator {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return newSliceIterator(s.data, string(prefix))
+}
+
+// NewBatch returns a batch applied to the store at once.
+func (s *MemoryStore) NewBatch() Batch {
+	return &mapBatch{write: func(ops []batchOp) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		applyBatch(s.data, ops)
+		return nil
+	}}
+}
+
+// NewSnapshot returns a copy of current key/value pairs.
+func (s *MemoryStore) NewSnapshot() (Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return newMapSnapshot(s.data), nil
+}
+
+// Close does nothing for memory store.
+func (s *MemoryStore) Close() {}
+
+// batchOp is a put or delete in a batch.
+type batchOp struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+// mapBatch is a batch of stores backed by a map.
+type mapBatch struct {
+	ops   []batchOp
+	write func(ops []batchOp) error
+}
+
+func (b *mapBatch) Put(key []byte, value []byte) {
+	b.ops = append(b.ops, batchOp{key: string(key), value: copyBytes(value)})
+}
+
+func (b *mapBatch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: string(key), delete: true})
+}
+
+func (b *mapBatch) Len() int {
+	return len(b.ops)
+}
+
+func (b *mapBatch) Write() error {
+	return b.write(b.ops)
+}
+
+// applyBatch applies operations of a batch to given data in order.
+func applyBatch(data map[string][]byte, ops []batchOp) {
+	for _, op := range ops {
+		if op.delete {
+			delete(data, op.key)
+		} else {
+			data[op.key] = op.value
+		}
+	}
+}
+
+// mapSnapshot is a snapshot of stores backed by a map.
+type mapSnapshot struct {
+	data map[string][]byte
+}
+
+// newMapSnapshot returns a snapshot with a copy of given data.
+// Values are not copied because they are replaced rather than modified in stores.
+func newMapSnapshot(data map[string][]byte) *mapSnapshot {
+	copied := make(map[string][]byte, len(data))
+	for k, v := range data {
+		copied[k] = v
+	}
+	return &mapSnapshot{data: copied}
+}
+
+func (s *mapSnapshot) Has(key []byte) (bool, error) {
+	_, ok := s.data[string(key)]
+	return ok, nil
+}
+
+func (s *mapSnapshot) Get(key []byte) ([]byte, error) {
+	val, ok := s.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyBytes(val), nil
+}
+
+func (s *mapSnapshot) NewIteratorWithPrefix(prefix []byte) Iterator {
+	return newSliceIterator(s.data, string(prefix))
+}
+
+func (s *mapSnapshot) Release() {
+	s.data = nil
+}
+
+// sliceIterator iterates sorted key/value pairs copied from a map.
+type sliceIterator struct {
+	keys   []string
+	values [][]byte
+	pos    int
+}
+
+// newSliceIterator returns an iterator of pairs with given prefix in data.
+func newSliceIterator(data map[string][]byte, prefix string) *sliceIterator {
+	var keys []string
+	for k := range data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	values := make([][]byte, len(keys))
+	for i, k := range keys {
+		values[i] = copyBytes(data[k])
+	}
+	return &sliceIterator{keys: keys, values: values, pos: -1}
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.pos < len(it.keys) {
+		it.pos++
+	}
+	return it.pos < len(it.keys)
+}
+
+func (it *sliceIterator) Key() []byte {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.pos])
+}
+
+func (it *sliceIterator) Value() []byte {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.pos]
+}
+
+func (it *sliceIterator) Release() {
+	it.keys = nil
+	it.values = nil
+}
+
+func (it *sliceIterator) Error() error {
+	return nil
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
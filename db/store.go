@@ -0,0 +1,82 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// backends of a store
+const (
+	BackendLevelDB = "leveldb"
+	BackendJSON    = "json"
+	BackendMemory  = "memory"
+)
+
+// ErrNotFound is returned by Get if a key doesn't exist in a store.
+var ErrNotFound = errors.New("db: not found")
+
+// Reader reads key/value pairs from a store or a snapshot.
+type Reader interface {
+	// Has returns true if its present in the store, otherwise false.
+	Has(key []byte) (bool, error)
+	// Get returns a value given key or ErrNotFound.
+	Get(key []byte) ([]byte, error)
+	// NewIteratorWithPrefix returns the key space given prefix in order of keys.
+	NewIteratorWithPrefix(prefix []byte) Iterator
+}
+
+// Store is a key-value store of myutils.
+type Store interface {
+	Reader
+	// Put inserts the given value into the store.
+	Put(key []byte, value []byte) error
+	// Delete removes the key from the store.
+	Delete(key []byte) error
+	// NewBatch returns a batch to write multiple changes atomically.
+	NewBatch() Batch
+	// NewSnapshot returns a point-in-time view of the store.
+	NewSnapshot() (Snapshot, error)
+	// Close closes the store.
+	Close()
+}
+
+// Iterator iterates key/value pairs of a store.
+// Release must be called after iteration.
+type Iterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Release()
+	Error() error
+}
+
+// Snapshot is a point-in-time view of a store not affected by later writes.
+// Release must be called after use.
+type Snapshot interface {
+	Reader
+	Release()
+}
+
+// Batch is a set of changes written to a store atomically.
+type Batch interface {
+	Put(key []byte, value []byte)
+	Delete(key []byte)
+	// Len returns the number of changes in the batch.
+	Len() int
+	// Write writes changes to the store.
+	Write() error
+}
+
+// Open returns a store given backend. path is ignored by memory backend.
+func Open(backend, path string) (Store, error) {
+	switch backend {
+	case "", BackendLevelDB:
+		return NewDatabase(path, nil)
+	case BackendJSON:
+		return NewJSONStore(path)
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown db backend : %s", backend)
+	}
+}
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestStores returns stores of all backends in a temporary directory.
+func openTestStores(t *testing.T) (map[string]Store, func()) {
+	dir, err := ioutil.TempDir("", "myutils-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := make(map[string]Store)
+	for _, backend := range []string{BackendMemory, BackendJSON, BackendLevelDB} {
+		store, err := Open(backend, filepath.Join(dir, backend))
+		if err != nil {
+			t.Fatalf("cannot open %s store. %v", backend, err)
+		}
+		stores[backend] = store
+	}
+	return stores, func() {
+		for _, s := range stores {
+			s.Close()
+		}
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestStoreContract(t *testing.T) {
+	stores, closeAll := openTestStores(t)
+	defer closeAll()
+
+	for backend, store := range stores {
+		t.Run(backend, func(t *testing.T) {
+			if _, err := store.Get([]byte("none")); err != ErrNotFound {
+				t.Fatalf("expected ErrNotFound but %v", err)
+			}
+			for _, k := range []string{"host.b", "host.a", "tunnel.a"} {
+				if err := store.Put([]byte(k), []byte("v-"+k)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if has, err := store.Has([]byte("host.a")); err != nil || !has {
+				t.Fatalf("expected host.a exists but %v, %v", has, err)
+			}
+			val, err := store.Get([]byte("host.b"))
+			if err != nil || string(val) != "v-host.b" {
+				t.Fatalf("unexpected value %s, %v", val, err)
+			}
+
+			snapshot, err := store.NewSnapshot()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer snapshot.Release()
+
+			batch := store.NewBatch()
+			batch.Delete([]byte("host.a"))
+			batch.Put([]byte("host.c"), []byte("v-host.c"))
+			if batch.Len() != 2 {
+				t.Fatalf("expected batch len 2 but %d", batch.Len())
+			}
+			if has, _ := store.Has([]byte("host.c")); has {
+				t.Fatal("batch is written before Write")
+			}
+			if err := batch.Write(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := iterateKeys(t, store, "host."); !equalStrings(got, []string{"host.b", "host.c"}) {
+				t.Errorf("unexpected keys of store %v", got)
+			}
+			if got := iterateKeys(t, snapshot, "host."); !equalStrings(got, []string{"host.a", "host.b"}) {
+				t.Errorf("unexpected keys of snapshot %v", got)
+			}
+			if err := store.Delete([]byte("host.b")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get([]byte("host.b")); err != ErrNotFound {
+				t.Errorf("expected ErrNotFound after delete but %v", err)
+			}
+		})
+	}
+}
+
+func TestJSONStoreKeepsValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "myutils-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "db.json")
+
+	values := map[string][]byte{
+		"compact":    []byte(`{"name":"a","port":22}`),
+		"whitespace": []byte("{ \"name\" : \"a\" }\n"),
+		"html":       []byte(`{"cmd":"a && b > c"}`),
+		"number":     []byte(`7`),
+		"binary":     {0xff, 0x00, 0x01},
+		"empty":      {},
+	}
+	store, err := NewJSONStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range values {
+		if err := store.Put([]byte(k), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	store, err = NewJSONStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for k, v := range values {
+		got, err := store.Get([]byte(k))
+		if err != nil {
+			t.Fatalf("%s: %v", k, err)
+		}
+		if !bytes.Equal(got, v) {
+			t.Errorf("%s: expected %q but %q", k, v, got)
+		}
+	}
+}
+
+func TestJSONStoreLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "myutils-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "db.json")
+
+	store, err := NewJSONStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenWithTimeout(BackendJSON, path, 0); err == nil {
+		t.Fatal("expected busy error while locked")
+	}
+	store.Close()
+
+	reopened, err := OpenWithTimeout(BackendJSON, path, 0)
+	if err != nil {
+		t.Fatalf("expected to open after closed but %v", err)
+	}
+	reopened.Close()
+}
+
+func TestBackupRestore(t *testing.T) {
+	src := NewMemoryStore()
+	entries := map[string]string{
+		"host.a":              `{"name":"a"}`,
+		"meta.schema.version": "2",
+		"binary":              "\xff\x00",
+	}
+	for k, v := range entries {
+		_ = src.Put([]byte(k), []byte(v))
+	}
+
+	var archive bytes.Buffer
+	manifest, err := Backup(src, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Entries != len(entries) {
+		t.Fatalf("expected %d entries but %d", len(entries), manifest.Entries)
+	}
+
+	corrupted := append([]byte(nil), archive.Bytes()...)
+	corrupted[len(corrupted)/2] ^= 0xff
+	if _, _, err := ReadBackup(bytes.NewReader(corrupted)); err == nil {
+		t.Error("expected an error of corrupted archive")
+	}
+
+	_, restored, err := ReadBackup(&archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := NewMemoryStore()
+	_ = dest.Put([]byte("stale"), []byte("x"))
+	if err := Restore(dest, restored); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := dest.Has([]byte("stale")); has {
+		t.Error("expected stale entry is removed by restore")
+	}
+	for k, v := range entries {
+		got, err := dest.Get([]byte(k))
+		if err != nil || string(got) != v {
+			t.Errorf("%s: expected %q but %q, %v", k, v, got, err)
+		}
+	}
+}
+
+func iterateKeys(t *testing.T, r Reader, prefix string) []string {
+	itr := r.NewIteratorWithPrefix([]byte(prefix))
+	defer itr.Release()
+	var keys []string
+	for itr.Next() {
+		keys = append(keys, string(itr.Key()))
+	}
+	if err := itr.Error(); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/types"
+	"github.com/zacscoding/myutils/utils"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// digits of version in history keys to keep them ordered
+const historyVersionDigits = 10
+
+// GetHistory returns versions of a host with given name in order.
+func GetHistory(db db.Reader, hostname string) ([]*types.History, error) {
+	prefix := getHistoryPrefix(hostname)
+	itr := db.NewIteratorWithPrefix(prefix)
+	defer itr.Release()
+
+	var histories []*types.History
+	for itr.Next() {
+		// skip histories of other hosts which names start with hostname + "."
+		if len(itr.Key())-len(prefix) != historyVersionDigits {
+			continue
+		}
+		var h *types.History
+		if err := json.Unmarshal(itr.Value(), &h); err != nil {
+			return nil, fmt.Errorf("invalid history %s. %v", string(itr.Key()), err)
+		}
+		histories = append(histories, h)
+	}
+	return histories, itr.Error()
+}
+
+// RevertHost reverts a host to the state after a given version and records it as a new version.
+// If version is 0, reverts the latest change. The host is deleted if it didn't exist at the version.
+func RevertHost(db db.Store, hostname string, version int) (*types.History, error) {
+	histories, err := GetHistory(db, hostname)
+	if err != nil {
+		return nil, err
+	}
+	if len(histories) == 0 {
+		return nil, fmt.Errorf("empty history of host %s", hostname)
+	}
+
+	var target *types.Host
+	if version == 0 {
+		target = histories[len(histories)-1].Before
+	} else {
+		found := false
+		for _, h := range histories {
+			if h.Version == version {
+				target = h.After
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("cannot find version %d of host %s", version, hostname)
+		}
+	}
+
+	current, err := findHost(db, hostname)
+	if err != nil {
+		return nil, err
+	}
+	batch := db.NewBatch()
+	if target == nil {
+		if current == nil {
+			return nil, fmt.Errorf("host %s already doesn't exist", hostname)
+		}
+		batch.Delete(getHostKey(hostname))
+	} else {
+		// versions before a rename have the old name
+		target.Name = hostname
+		encoded, err := encodeHost(target)
+		if err != nil {
+			return nil, err
+		}
+		batch.Put(getHostKey(hostname), encoded)
+	}
+	history, err := recordHistory(db, batch, types.HistoryRevert, hostname, current, target)
+	if err != nil {
+		return nil, err
+	}
+	return history, batch.Write()
+}
+
+// Diff returns changed fields between two versions of a host. Passwords are masked.
+func Diff(before, after *types.Host) []string {
+	beforeFields := hostFields(before)
+	afterFields := hostFields(after)
+
+	names := make(map[string]bool)
+	for name := range beforeFields {
+		names[name] = true
+	}
+	for name := range afterFields {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	var diff []string
+	for _, name := range sorted {
+		b, bok := beforeFields[name]
+		a, aok := afterFields[name]
+		if bok && aok && reflect.DeepEqual(a, b) {
+			continue
+		}
+		diff = append(diff, fmt.Sprintf("%s: %s -> %s", name, formatField(name, b, bok), formatField(name, a, aok)))
+	}
+	return diff
+}
+
+// recordHistory adds a new version of a host changed by an action to the batch.
+func recordHistory(db db.Reader, batch db.Batch, action, hostname string, before, after *types.Host) (*types.History, error) {
+	version, err := latestVersion(db, hostname)
+	if err != nil {
+		return nil, err
+	}
+	history := newHistory(version+1, action, hostname, before, after)
+	encoded, err := json.Marshal(history)
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(getHistoryKey(hostname, history.Version), encoded)
+	return history, nil
+}
+
+// newHistory returns a version of host history changed by current user.
+func newHistory(version int, action, hostname string, before, after *types.Host) *types.History {
+	return &types.History{
+		Version: version,
+		Name:    hostname,
+		Action:  action,
+		User:    utils.CurrentUser(),
+		Time:    time.Now(),
+		Before:  before,
+		After:   after,
+		Diff:    Diff(before, after),
+	}
+}
+
+// latestVersion returns the latest version of a host or 0 if no history.
+func latestVersion(db db.Reader, hostname string) (int, error) {
+	prefix := getHistoryPrefix(hostname)
+	itr := db.NewIteratorWithPrefix(prefix)
+	defer itr.Release()
+
+	latest := 0
+	for itr.Next() {
+		suffix := string(itr.Key()[len(prefix):])
+		if len(suffix) != historyVersionDigits {
+			continue
+		}
+		if version, err := strconv.Atoi(suffix); err == nil && version > latest {
+			latest = version
+		}
+	}
+	return latest, itr.Error()
+}
+
+// hostFields returns json fields of a host.
+func hostFields(h *types.Host) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if h == nil {
+		return fields
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(b, &fields)
+	return fields
+}
+
+// formatField returns a value of a field to display.
+func formatField(name string, value interface{}, ok bool) string {
+	if !ok {
+		return "<none>"
+	}
+	if name == "password" {
+		if value == "" {
+			return `""`
+		}
+		return "***"
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
+
+// getHistoryPrefix returns a prefix of history keys given host name i.e "history.<name>."
+func getHistoryPrefix(hostname string) []byte {
+	return []byte(types.HistoryPrefix + hostname + ".")
+}
+
+// getHistoryKey returns a key given host name and version i.e "history.<name>.0000000001"
+func getHistoryKey(hostname string, version int) []byte {
+	return []byte(fmt.Sprintf("%s%s.%0*d", types.HistoryPrefix, hostname, historyVersionDigits, version))
+}
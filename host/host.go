@@ -8,26 +8,24 @@ import (
 	"github.com/zacscoding/myutils/db"
 	"github.com/zacscoding/myutils/types"
 	"log"
+	"sort"
 )
 
-// AddHost save a given host into local db
-func AddHost(db *db.Database, host *types.Host) error {
-	if !host.HasCredentials() {
-		hostStr := ""
-		b, err := json.Marshal(host)
-		if err == nil {
-			hostStr = string(b)
-		}
-		return errors.New("must have at least password or key path :" + hostStr)
-	}
+// UnsettableFields are names of optional fields to be cleared by UnsetField
+var UnsettableFields = []string{"password", "keypath", "description", "tags", "forwards", "forward-agent", "keepalive", "keepalive-max-missed"}
 
-	key := getHostKey(host.Name)
-	encoded, err := json.Marshal(host)
+// AddHost save a given host into local db with history
+func AddHost(db db.Store, host *types.Host) error {
+	if err := Validate(host); err != nil {
+		return err
+	}
+	batch := db.NewBatch()
+	encoded, err := putHost(db, batch, types.HistoryAdd, host)
 	if err != nil {
 		return err
 	}
 
-	err = db.Put(key, encoded)
+	err = batch.Write()
 	if err != nil {
 		return err
 	}
@@ -35,8 +33,51 @@ func AddHost(db *db.Database, host *types.Host) error {
 	return nil
 }
 
+// AddHosts save given hosts into local db atomically.
+// Nothing is saved if any host is invalid or names are duplicate.
+func AddHosts(db db.Store, hosts []*types.Host) error {
+	if err := ValidateHosts(hosts); err != nil {
+		return err
+	}
+	batch := db.NewBatch()
+	for _, h := range hosts {
+		if _, err := putHost(db, batch, types.HistoryImport, h); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// TagHosts adds and removes tags of hosts with given names atomically.
+// Returns updated hosts or an error without changes if any host doesn't exist.
+func TagHosts(db db.Store, hostnames []string, add, remove []string) ([]*types.Host, error) {
+	snapshot, err := db.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snapshot.Release()
+
+	batch := db.NewBatch()
+	var hosts []*types.Host
+	for _, name := range hostnames {
+		h, err := GetHost(snapshot, name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find a host %s. %v", name, err)
+		}
+		h.Tags = editTags(h.Tags, add, remove)
+		if _, err := putHost(snapshot, batch, types.HistoryTag, h); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, h)
+	}
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
 // GetHost returns a host given hostname
-func GetHost(db *db.Database, hostname string) (*types.Host, error) {
+func GetHost(db db.Reader, hostname string) (*types.Host, error) {
 	val, err := db.Get(getHostKey(hostname))
 	if err != nil {
 		return nil, err
@@ -51,8 +92,9 @@ func GetHost(db *db.Database, hostname string) (*types.Host, error) {
 }
 
 // GetHosts returns list of hosts from db
-func GetHosts(db *db.Database) ([]*types.Host, error) {
+func GetHosts(db db.Reader) ([]*types.Host, error) {
 	itr := db.NewIteratorWithPrefix([]byte(types.HostPrefix))
+	defer itr.Release()
 	var hosts []*types.Host
 
 	for itr.Next() {
@@ -64,11 +106,11 @@ func GetHosts(db *db.Database) ([]*types.Host, error) {
 
 		hosts = append(hosts, h)
 	}
-	return hosts, nil
+	return hosts, itr.Error()
 }
 
 // UpdateHost update a given host into local stored.
-func UpdateHost(db *db.Database, h *types.Host) error {
+func UpdateHost(db db.Store, h *types.Host) error {
 	has, err := db.Has(getHostKey(h.Name))
 	if err != nil {
 		return err
@@ -77,16 +119,160 @@ func UpdateHost(db *db.Database, h *types.Host) error {
 		return errors.New("Not exist host with name " + h.Name)
 	}
 
-	err = AddHost(db, h)
+	batch := db.NewBatch()
+	encoded, err := putHost(db, batch, types.HistoryUpdate, h)
+	if err != nil {
+		return err
+	}
+	err = batch.Write()
 	if err == nil {
+		log.Println("Success to save a host : ", string(encoded))
 		log.Println("Success to update")
 	}
 	return err
 }
 
-// DeleteHost delete a host with given name.
-func DeleteHost(db *db.Database, hostname string) error {
-	return db.Delete(getHostKey(hostname))
+// EditHost applies an edit to a stored host and saves it with history if anything changed.
+// Returns changed fields of the host.
+func EditHost(db db.Store, hostname string, edit func(h *types.Host) error) ([]string, error) {
+	snapshot, err := db.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snapshot.Release()
+
+	before, err := findHost(snapshot, hostname)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, errors.New("Not exist host with name " + hostname)
+	}
+	after, err := GetHost(snapshot, hostname)
+	if err != nil {
+		return nil, err
+	}
+	if err := edit(after); err != nil {
+		return nil, err
+	}
+	if after.Name != hostname {
+		return nil, errors.New("cannot change a name of host. use rename instead")
+	}
+	diff := Diff(before, after)
+	if len(diff) == 0 {
+		return nil, nil
+	}
+	if after.KeyPath != before.KeyPath {
+		if err := validationError(validateKeyFile(after, hostname)); err != nil {
+			return nil, err
+		}
+	}
+
+	batch := db.NewBatch()
+	if _, err := putHost(snapshot, batch, types.HistoryUpdate, after); err != nil {
+		return nil, err
+	}
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// UnsetField clears an optional field of a host given a name of the field i.e password, keypath or tags.
+func UnsetField(h *types.Host, field string) error {
+	switch field {
+	case "password":
+		h.Password = ""
+	case "keypath":
+		h.KeyPath = ""
+	case "description":
+		h.Description = ""
+	case "tags":
+		h.Tags = nil
+	case "forwards":
+		h.Forwards = nil
+	case "forward-agent":
+		h.ForwardAgent = false
+	case "keepalive":
+		h.KeepAlive = 0
+	case "keepalive-max-missed":
+		h.KeepAliveMaxMissed = 0
+	default:
+		return fmt.Errorf("cannot unset a field %s. unsettable fields are %v", field, UnsettableFields)
+	}
+	return nil
+}
+
+// DeleteHost delete a host with given name with history.
+func DeleteHost(db db.Store, hostname string) error {
+	before, err := findHost(db, hostname)
+	if err != nil {
+		return err
+	}
+	if before == nil {
+		return nil
+	}
+	batch := db.NewBatch()
+	batch.Delete(getHostKey(hostname))
+	if _, err := recordHistory(db, batch, types.HistoryDelete, hostname, before, nil); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// putHost adds a given host and a new version of history to the batch.
+// Returns encoded host.
+func putHost(db db.Reader, batch db.Batch, action string, h *types.Host) ([]byte, error) {
+	encoded, err := encodeHost(h)
+	if err != nil {
+		return nil, err
+	}
+	before, err := findHost(db, h.Name)
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(getHostKey(h.Name), encoded)
+	if _, err := recordHistory(db, batch, action, h.Name, before, h); err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
+
+// findHost returns a host given hostname or nil if not exist.
+func findHost(reader db.Reader, hostname string) (*types.Host, error) {
+	h, err := GetHost(reader, hostname)
+	if err == db.ErrNotFound {
+		return nil, nil
+	}
+	return h, err
+}
+
+// encodeHost returns json of a given host if structurally valid.
+func encodeHost(host *types.Host) ([]byte, error) {
+	if err := validationError(validateHost(host, host.Name)); err != nil {
+		return nil, err
+	}
+	return json.Marshal(host)
+}
+
+// editTags returns sorted tags with added tags and without removed tags.
+func editTags(tags, add, remove []string) []string {
+	set := make(map[string]bool)
+	for _, t := range tags {
+		set[t] = true
+	}
+	for _, t := range add {
+		set[t] = true
+	}
+	for _, t := range remove {
+		delete(set, t)
+	}
+	edited := make([]string, 0, len(set))
+	for t := range set {
+		edited = append(edited, t)
+	}
+	sort.Strings(edited)
+	return edited
 }
 
 // getHostKey returns a key given host with prefix("host.")
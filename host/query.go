@@ -0,0 +1,213 @@
+package host
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/types"
+	"net"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SortFields are fields to sort hosts. A field prefixed with "-" sorts in descending order.
+var SortFields = []string{"name", "address", "user", "port"}
+
+// Query is conditions to find hosts. Empty conditions match all hosts.
+type Query struct {
+	// Names are glob patterns of host names. A host matches if any pattern matches
+	Names []string
+	// Address is a CIDR like 10.0.0.0/24 or an ip of host addresses
+	Address string
+	User    string
+	// Tags are tags which a host must have all
+	Tags []string
+	// Text is a case-insensitive text in description
+	Text string
+	// Sort is a field of SortFields. default is name
+	Sort string
+	// Limit is a max number of hosts. 0 is unlimited
+	Limit  int
+	Offset int
+
+	network *net.IPNet
+}
+
+// FindHosts returns hosts matched by a query in the order of the query
+// and total number of matched hosts before limit and offset.
+func FindHosts(db db.Reader, q *Query) ([]*types.Host, int, error) {
+	if err := q.compile(); err != nil {
+		return nil, 0, err
+	}
+	hosts, err := GetHosts(db)
+	if err != nil {
+		return nil, 0, err
+	}
+	var matched []*types.Host
+	for _, h := range hosts {
+		if q.Match(h) {
+			matched = append(matched, h)
+		}
+	}
+	sortHosts(matched, q.Sort)
+	return page(matched, q.Offset, q.Limit), len(matched), nil
+}
+
+// Match returns true if a host matches all conditions of the query.
+func (q *Query) Match(h *types.Host) bool {
+	if len(q.Names) != 0 && !matchAny(q.Names, h.Name) {
+		return false
+	}
+	if q.Address != "" && !q.matchAddress(h.Address) {
+		return false
+	}
+	if q.User != "" && q.User != h.User {
+		return false
+	}
+	for _, t := range q.Tags {
+		if !hasTag(h, t) {
+			return false
+		}
+	}
+	if q.Text != "" && !strings.Contains(strings.ToLower(h.Description), strings.ToLower(q.Text)) {
+		return false
+	}
+	return true
+}
+
+// compile checks conditions of the query and parses the address.
+func (q *Query) compile() error {
+	for _, pattern := range q.Names {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid name pattern %s. %v", pattern, err)
+		}
+	}
+	q.network = nil
+	if q.Address != "" {
+		network, err := parseNetwork(q.Address)
+		if err != nil {
+			return err
+		}
+		q.network = network
+	}
+	field := strings.TrimPrefix(q.Sort, "-")
+	if field != "" && !contains(SortFields, field) {
+		return fmt.Errorf("cannot sort by %s. sort fields are %v", q.Sort, SortFields)
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return fmt.Errorf("limit and offset must not be negative")
+	}
+	return nil
+}
+
+// matchAddress returns true if a given address is an ip in the network of the query.
+// Addresses of hostnames are not resolved so never matched.
+func (q *Query) matchAddress(address string) bool {
+	network := q.network
+	if network == nil {
+		var err error
+		if network, err = parseNetwork(q.Address); err != nil {
+			return false
+		}
+	}
+	ip := net.ParseIP(address)
+	return ip != nil && network.Contains(ip)
+}
+
+// parseNetwork returns a network given a CIDR or a single ip.
+func parseNetwork(address string) (*net.IPNet, error) {
+	if strings.Contains(address, "/") {
+		_, network, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s. %v", address, err)
+		}
+		return network, nil
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %s. must be a CIDR or an ip", address)
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// sortHosts sorts hosts by a field and names for the same values.
+func sortHosts(hosts []*types.Host, field string) {
+	desc := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+	compare := func(a, b *types.Host) int {
+		switch field {
+		case "address":
+			return compareAddress(a.Address, b.Address)
+		case "user":
+			return strings.Compare(a.User, b.User)
+		case "port":
+			return a.Port - b.Port
+		}
+		return 0
+	}
+	sort.SliceStable(hosts, func(i, j int) bool {
+		c := compare(hosts[i], hosts[j])
+		if c == 0 {
+			c = strings.Compare(hosts[i].Name, hosts[j].Name)
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// compareAddress compares ips numerically and others as strings after ips.
+func compareAddress(a, b string) int {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	switch {
+	case ipA != nil && ipB != nil:
+		return bytes.Compare(ipA.To16(), ipB.To16())
+	case ipA != nil:
+		return -1
+	case ipB != nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// page returns hosts in a range of offset and limit.
+func page(hosts []*types.Host, offset, limit int) []*types.Host {
+	if offset >= len(hosts) {
+		return nil
+	}
+	hosts = hosts[offset:]
+	if limit > 0 && limit < len(hosts) {
+		hosts = hosts[:limit]
+	}
+	return hosts
+}
+
+// matchAny returns true if any glob pattern matches a given name.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTag returns true if a host has a given tag.
+func hasTag(h *types.Host, tag string) bool {
+	return contains(h.Tags, tag)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package host
+
+import (
+	"encoding/json"
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/types"
+	"testing"
+)
+
+func TestFindHosts(t *testing.T) {
+	store := db.NewMemoryStore()
+	hosts := []*types.Host{
+		{Name: "web-1", User: "app", Address: "10.0.1.10", Port: 22, Tags: []string{"prod", "web"}, Description: "Primary web"},
+		{Name: "web-2", User: "app", Address: "10.0.1.9", Port: 2222, Tags: []string{"web"}},
+		{Name: "db-1", User: "root", Address: "10.0.2.5", Port: 5022, Tags: []string{"prod", "db"}, Description: "database"},
+		{Name: "ext", User: "root", Address: "example.com", Port: 22},
+	}
+	for _, h := range hosts {
+		encoded, _ := json.Marshal(h)
+		_ = store.Put(getHostKey(h.Name), encoded)
+	}
+
+	cases := []struct {
+		name  string
+		query Query
+		names []string
+		total int
+		fail  bool
+	}{
+		{name: "all sorted by name", query: Query{}, names: []string{"db-1", "ext", "web-1", "web-2"}, total: 4},
+		{name: "name globs", query: Query{Names: []string{"web-*", "db-?"}}, names: []string{"db-1", "web-1", "web-2"}, total: 3},
+		{name: "cidr", query: Query{Address: "10.0.1.0/24"}, names: []string{"web-1", "web-2"}, total: 2},
+		{name: "single ip", query: Query{Address: "10.0.2.5"}, names: []string{"db-1"}, total: 1},
+		{name: "user", query: Query{User: "root"}, names: []string{"db-1", "ext"}, total: 2},
+		{name: "all tags", query: Query{Tags: []string{"prod", "web"}}, names: []string{"web-1"}, total: 1},
+		{name: "text ignores case", query: Query{Text: "WEB"}, names: []string{"web-1"}, total: 1},
+		{name: "sort by address", query: Query{Sort: "address"}, names: []string{"web-2", "web-1", "db-1", "ext"}, total: 4},
+		{name: "sort by port desc", query: Query{Sort: "-port"}, names: []string{"db-1", "web-2", "web-1", "ext"}, total: 4},
+		{name: "limit and offset", query: Query{Limit: 2, Offset: 1}, names: []string{"ext", "web-1"}, total: 4},
+		{name: "offset out of range", query: Query{Offset: 10}, names: nil, total: 4},
+		{name: "invalid sort", query: Query{Sort: "password"}, fail: true},
+		{name: "invalid cidr", query: Query{Address: "10.0.0.300/8"}, fail: true},
+		{name: "invalid glob", query: Query{Names: []string{"web-["}}, fail: true},
+		{name: "negative limit", query: Query{Limit: -1}, fail: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			found, total, err := FindHosts(store, &c.query)
+			if c.fail {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, h := range found {
+				names = append(names, h.Name)
+			}
+			if !equalNames(names, c.names) || total != c.total {
+				t.Errorf("expected %v(%d) but %v(%d)", c.names, c.total, names, total)
+			}
+		})
+	}
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
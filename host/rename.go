@@ -0,0 +1,124 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/types"
+)
+
+// RenameHost adds changes to rename a host from oldName to newName into the batch.
+// History of the host is moved to the new name after existing history of the new name if any,
+// and a rename version is recorded. Other records referencing the host must be updated in the same batch.
+func RenameHost(db db.Reader, batch db.Batch, oldName, newName string) (*types.Host, error) {
+	if newName == "" {
+		return nil, fmt.Errorf("new host name must not be empty")
+	}
+	if oldName == newName {
+		return nil, fmt.Errorf("host %s is already named %s", oldName, newName)
+	}
+	before, err := findHost(db, oldName)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil {
+		return nil, fmt.Errorf("cannot find a host %s", oldName)
+	}
+	exist, err := findHost(db, newName)
+	if err != nil {
+		return nil, err
+	}
+	if exist != nil {
+		return nil, fmt.Errorf("already exist host with name %s", newName)
+	}
+
+	after := *before
+	after.Name = newName
+	encoded, err := encodeHost(&after)
+	if err != nil {
+		return nil, err
+	}
+	batch.Delete(getHostKey(oldName))
+	batch.Put(getHostKey(newName), encoded)
+
+	// move history
+	offset, err := latestVersion(db, newName)
+	if err != nil {
+		return nil, err
+	}
+	histories, err := GetHistory(db, oldName)
+	if err != nil {
+		return nil, err
+	}
+	latest := offset
+	for _, h := range histories {
+		batch.Delete(getHistoryKey(oldName, h.Version))
+		h.Version += offset
+		h.Name = newName
+		h.Before = renamed(h.Before, newName)
+		h.After = renamed(h.After, newName)
+		encoded, err := json.Marshal(h)
+		if err != nil {
+			return nil, err
+		}
+		batch.Put(getHistoryKey(newName, h.Version), encoded)
+		latest = h.Version
+	}
+	history := newHistory(latest+1, types.HistoryRename, newName, before, &after)
+	encoded, err = json.Marshal(history)
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(getHistoryKey(newName, history.Version), encoded)
+	return &after, nil
+}
+
+// renamed returns a copy of a host version with a new name or nil if the host didn't exist at the version.
+func renamed(h *types.Host, name string) *types.Host {
+	if h == nil {
+		return nil
+	}
+	copied := *h
+	copied.Name = name
+	return &copied
+}
+
+// CloneHost save a copy of a host with a new name and overrides.
+// override is called with the copied host before saved if not nil.
+func CloneHost(db db.Store, srcName, newName string, override func(h *types.Host)) (*types.Host, error) {
+	src, err := findHost(db, srcName)
+	if err != nil {
+		return nil, err
+	}
+	if src == nil {
+		return nil, fmt.Errorf("cannot find a host %s", srcName)
+	}
+	exist, err := findHost(db, newName)
+	if err != nil {
+		return nil, err
+	}
+	if exist != nil {
+		return nil, fmt.Errorf("already exist host with name %s", newName)
+	}
+
+	clone := *src
+	clone.Name = newName
+	clone.Tags = append([]string(nil), src.Tags...)
+	clone.Forwards = append([]*types.Forward(nil), src.Forwards...)
+	if override != nil {
+		override(&clone)
+	}
+	if clone.Name != newName {
+		return nil, fmt.Errorf("name of a clone must be %s", newName)
+	}
+	if clone.KeyPath != src.KeyPath {
+		if err := validationError(validateKeyFile(&clone, newName)); err != nil {
+			return nil, err
+		}
+	}
+	batch := db.NewBatch()
+	if _, err := putHost(db, batch, types.HistoryClone, &clone); err != nil {
+		return nil, err
+	}
+	return &clone, batch.Write()
+}
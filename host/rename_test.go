@@ -0,0 +1,49 @@
+package host
+
+import (
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/types"
+	"testing"
+)
+
+// TestRevertRenamedHost checks a renamed host keeps its new name when reverted to versions before the rename.
+func TestRevertRenamedHost(t *testing.T) {
+	for _, version := range []int{0, 1} {
+		store := db.NewMemoryStore()
+		if err := AddHost(store, &types.Host{Name: "a", Address: "10.0.0.1", Port: 22, Password: "p"}); err != nil {
+			t.Fatal(err)
+		}
+		batch := store.NewBatch()
+		if _, err := RenameHost(store, batch, "a", "b"); err != nil {
+			t.Fatal(err)
+		}
+		if err := batch.Write(); err != nil {
+			t.Fatal(err)
+		}
+
+		histories, err := GetHistory(store, "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(histories) != 2 || histories[0].After.Name != "b" {
+			t.Fatalf("expected history moved to b but %v", histories)
+		}
+
+		if _, err := RevertHost(store, "b", version); err != nil {
+			t.Fatal(err)
+		}
+		h, err := GetHost(store, "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Name != "b" {
+			t.Errorf("version %d: expected name b after revert but %s", version, h.Name)
+		}
+		if _, err := EditHost(store, "b", func(h *types.Host) error {
+			h.Description = "changed"
+			return nil
+		}); err != nil {
+			t.Errorf("version %d: expected to update a reverted host but %v", version, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package host
+
+import (
+	"fmt"
+	"github.com/zacscoding/myutils/types"
+	"net"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const maxHostnameLength = 253
+
+// FieldError is an invalid field of a host.
+type FieldError struct {
+	// Host is a name of the host or an index like #1 if the host doesn't have a name
+	Host    string `json:"host"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s %s", e.Host, e.Field, e.Message)
+}
+
+// ValidationError is a list of invalid fields of hosts.
+type ValidationError []*FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return "invalid host " + strings.Join(msgs, ", ")
+}
+
+// Validate returns a ValidationError with all invalid fields of a given host or nil if valid.
+// A key file of the host must exist on this machine.
+func Validate(h *types.Host) error {
+	return validationError(append(validateHost(h, h.Name), validateKeyFile(h, h.Name)...))
+}
+
+// ValidateHosts returns a ValidationError with all invalid fields of given hosts and duplicate names or nil if valid.
+// Key files of the hosts must exist on this machine.
+func ValidateHosts(hosts []*types.Host) error {
+	var errs ValidationError
+	names := make(map[string]int)
+	for i, h := range hosts {
+		label := h.Name
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+		}
+		errs = append(errs, validateHost(h, label)...)
+		errs = append(errs, validateKeyFile(h, label)...)
+		if h.Name == "" {
+			continue
+		}
+		if first, ok := names[h.Name]; ok {
+			errs = append(errs, &FieldError{Host: label, Field: "name", Message: fmt.Sprintf("is duplicate of host #%d", first)})
+			continue
+		}
+		names[h.Name] = i + 1
+	}
+	return validationError(errs)
+}
+
+// validateHost returns structurally invalid fields of a host labeled by a given label.
+// Local files are not checked so that stored hosts can be changed on any machine.
+func validateHost(h *types.Host, label string) ValidationError {
+	var errs ValidationError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, &FieldError{Host: label, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case h.Name == "":
+		add("name", "is required")
+	case strings.IndexFunc(h.Name, unicode.IsSpace) >= 0:
+		add("name", "must not contain spaces")
+	case strings.ContainsAny(h.Name, "*?[]"):
+		add("name", "must not contain glob characters *?[]")
+	}
+
+	switch {
+	case h.Address == "":
+		add("address", "is required")
+	case !isValidAddress(h.Address):
+		add("address", "%q is not an ip or a hostname", h.Address)
+	}
+
+	if h.Port < 1 || h.Port > 65535 {
+		add("port", "%d is out of range 1-65535", h.Port)
+	}
+
+	if !h.HasCredentials() {
+		add("credentials", "must have at least password or key path")
+	}
+	if h.KeepAliveMaxMissed < 0 {
+		add("keepAliveMaxMissed", "must not be negative")
+	}
+
+	for _, t := range h.Tags {
+		if t == "" || strings.IndexFunc(t, unicode.IsSpace) >= 0 || strings.Contains(t, ",") {
+			add("tags", "%q must be non empty without spaces and commas", t)
+		}
+	}
+	return errs
+}
+
+// validateKeyFile returns an invalid key path of a host if the key file doesn't exist on this machine.
+func validateKeyFile(h *types.Host, label string) ValidationError {
+	if h.KeyPath == "" {
+		return nil
+	}
+	message := ""
+	if info, err := os.Stat(h.KeyPath); err != nil {
+		message = h.KeyPath + " doesn't exist"
+	} else if info.IsDir() {
+		message = h.KeyPath + " is a directory"
+	} else {
+		return nil
+	}
+	return ValidationError{{Host: label, Field: "keypath", Message: message}}
+}
+
+// isValidAddress returns true if a given address is an ip or a hostname.
+func isValidAddress(address string) bool {
+	if net.ParseIP(address) != nil {
+		return true
+	}
+	if len(address) > maxHostnameLength {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(address, "."), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validationError returns nil if no errors so that it can be returned as an error.
+func validationError(errs ValidationError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,111 @@
+package host
+
+import (
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/types"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	keyFile, err := ioutil.TempFile("", "myutils-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile.Close()
+	defer os.Remove(keyFile.Name())
+
+	valid := func(edit func(h *types.Host)) *types.Host {
+		h := &types.Host{Name: "web-1", User: "app", Address: "10.0.0.1", Port: 22, Password: "pwd"}
+		edit(h)
+		return h
+	}
+	cases := []struct {
+		name   string
+		host   *types.Host
+		fields []string
+	}{
+		{name: "valid", host: valid(func(h *types.Host) {})},
+		{name: "hostname address", host: valid(func(h *types.Host) { h.Address = "web-1.example.com" })},
+		{name: "existing key file", host: valid(func(h *types.Host) { h.Password, h.KeyPath = "", keyFile.Name() })},
+		{name: "empty name", host: valid(func(h *types.Host) { h.Name = "" }), fields: []string{"name"}},
+		{name: "name with spaces", host: valid(func(h *types.Host) { h.Name = "web 1" }), fields: []string{"name"}},
+		{name: "name with glob", host: valid(func(h *types.Host) { h.Name = "web*" }), fields: []string{"name"}},
+		{name: "empty address", host: valid(func(h *types.Host) { h.Address = "" }), fields: []string{"address"}},
+		{name: "invalid address", host: valid(func(h *types.Host) { h.Address = "a b" }), fields: []string{"address"}},
+		{name: "invalid port", host: valid(func(h *types.Host) { h.Port = 70000 }), fields: []string{"port"}},
+		{name: "no credentials", host: valid(func(h *types.Host) { h.Password = "" }), fields: []string{"credentials"}},
+		{name: "missing key file", host: valid(func(h *types.Host) { h.KeyPath = "/nonexistent/key" }), fields: []string{"keypath"}},
+		{name: "invalid tag", host: valid(func(h *types.Host) { h.Tags = []string{"a,b"} }), fields: []string{"tags"}},
+		{
+			name:   "multiple fields",
+			host:   &types.Host{Port: 0},
+			fields: []string{"name", "address", "port", "credentials"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := Validate(c.host)
+			if len(c.fields) == 0 {
+				if err != nil {
+					t.Fatalf("expected valid but %v", err)
+				}
+				return
+			}
+			validationErr, ok := err.(ValidationError)
+			if !ok {
+				t.Fatalf("expected ValidationError but %v", err)
+			}
+			if len(validationErr) != len(c.fields) {
+				t.Fatalf("expected fields %v but %v", c.fields, err)
+			}
+			for i, fe := range validationErr {
+				if fe.Field != c.fields[i] {
+					t.Errorf("expected field %s but %s", c.fields[i], fe.Field)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateHostsDuplicates(t *testing.T) {
+	hosts := []*types.Host{
+		{Name: "a", Address: "10.0.0.1", Port: 22, Password: "p"},
+		{Name: "a", Address: "10.0.0.2", Port: 22, Password: "p"},
+	}
+	validationErr, ok := ValidateHosts(hosts).(ValidationError)
+	if !ok || len(validationErr) != 1 || validationErr[0].Field != "name" {
+		t.Fatalf("expected a duplicate name error but %v", validationErr)
+	}
+}
+
+// TestStoredHostWithoutKeyFile checks stored hosts are changed without their key files on this machine.
+func TestStoredHostWithoutKeyFile(t *testing.T) {
+	store := db.NewMemoryStore()
+	h := &types.Host{Name: "a", Address: "10.0.0.1", Port: 22, KeyPath: "/nonexistent/key"}
+	if err := AddHost(store, h); err == nil {
+		t.Fatal("expected an error of missing key file")
+	}
+
+	encoded, err := encodeHost(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Put(getHostKey(h.Name), encoded)
+	if _, err := TagHosts(store, []string{"a"}, []string{"prod"}, nil); err != nil {
+		t.Errorf("expected to tag a host but %v", err)
+	}
+	if _, err := EditHost(store, "a", func(h *types.Host) error {
+		h.Description = "changed"
+		return nil
+	}); err != nil {
+		t.Errorf("expected to edit a host but %v", err)
+	}
+	if _, err := EditHost(store, "a", func(h *types.Host) error {
+		h.KeyPath = "/nonexistent/other"
+		return nil
+	}); err == nil {
+		t.Error("expected an error of a new missing key file")
+	}
+}
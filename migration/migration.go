@@ -0,0 +1,105 @@
+// migration is upgrading stored records to the latest schema version with ordered steps.
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/types"
+	"strconv"
+)
+
+// Migration is a step upgrading records from Version-1 to Version.
+type Migration struct {
+	Version     int
+	Description string
+	// Migrate adds changes of records to the batch and returns descriptions of changes.
+	Migrate func(store db.Store, batch db.Batch) ([]string, error)
+}
+
+// Result is a result of a migration step.
+type Result struct {
+	Version     int
+	Description string
+	Changes     []string
+}
+
+// LatestVersion returns the latest schema version.
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// GetVersion returns a schema version of a store. Returns 0 if the store has no version.
+func GetVersion(store db.Reader) (int, error) {
+	val, err := store.Get([]byte(types.SchemaVersionKey))
+	if err == db.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(string(val))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %s. %v", string(val), err)
+	}
+	return version, nil
+}
+
+// Run applies pending migrations to a store in order. Each step is written with the version in a batch,
+// so the store is always at a version even if a step fails.
+// If dryRun is true, returns pending changes without writing them. Note that steps of dry run
+// read records without changes of previous pending steps.
+func Run(store db.Store, dryRun bool) ([]*Result, error) {
+	current, err := GetVersion(store)
+	if err != nil {
+		return nil, err
+	}
+	latest := LatestVersion()
+	if current > latest {
+		return nil, fmt.Errorf("schema version %d of the store is newer than supported version %d. upgrade myutils",
+			current, latest)
+	}
+
+	var results []*Result
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		batch := store.NewBatch()
+		changes, err := m.Migrate(store, batch)
+		if err != nil {
+			return results, fmt.Errorf("failed to migrate to version %d(%s). %v", m.Version, m.Description, err)
+		}
+		batch.Put([]byte(types.SchemaVersionKey), []byte(strconv.Itoa(m.Version)))
+		if !dryRun {
+			if err := batch.Write(); err != nil {
+				return results, fmt.Errorf("failed to write version %d. %v", m.Version, err)
+			}
+		}
+		results = append(results, &Result{
+			Version:     m.Version,
+			Description: m.Description,
+			Changes:     changes,
+		})
+	}
+	return results, nil
+}
+
+// validate checks versions of migrations are sequential from 1.
+func validate() error {
+	if len(migrations) == 0 {
+		return errors.New("empty migrations")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration version must be %d but %d", i+1, m.Version)
+		}
+	}
+	return nil
+}
+
+func init() {
+	if err := validate(); err != nil {
+		panic(err)
+	}
+}
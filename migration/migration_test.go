@@ -0,0 +1,101 @@
+package migration
+
+import (
+	"encoding/json"
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/types"
+	"strconv"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		name    string
+		version string
+		hosts   map[string]string
+		dryRun  bool
+		steps   int
+		ports   map[string]float64
+		fail    bool
+	}{
+		{
+			name:  "unversioned store",
+			hosts: map[string]string{"a": `{"name":"a"}`, "b": `{"name":"b","port":2222}`},
+			steps: LatestVersion(),
+			ports: map[string]float64{"a": 22, "b": 2222},
+		},
+		{
+			name:   "dry run",
+			hosts:  map[string]string{"a": `{"name":"a"}`},
+			dryRun: true,
+			steps:  LatestVersion(),
+			ports:  map[string]float64{"a": 0},
+		},
+		{
+			name:    "latest store",
+			version: strconv.Itoa(LatestVersion()),
+			hosts:   map[string]string{"a": `{"name":"a"}`},
+			ports:   map[string]float64{"a": 0},
+		},
+		{
+			name:    "newer store",
+			version: strconv.Itoa(LatestVersion() + 1),
+			fail:    true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := db.NewMemoryStore()
+			if c.version != "" {
+				_ = store.Put([]byte(types.SchemaVersionKey), []byte(c.version))
+			}
+			for name, h := range c.hosts {
+				_ = store.Put([]byte(types.HostPrefix+name), []byte(h))
+			}
+
+			results, err := Run(store, c.dryRun)
+			if c.fail {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != c.steps {
+				t.Errorf("expected %d steps but %d", c.steps, len(results))
+			}
+			version, err := GetVersion(store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := LatestVersion()
+			if c.dryRun {
+				expected = 0
+			}
+			if version != expected {
+				t.Errorf("expected version %d but %d", expected, version)
+			}
+			for name, port := range c.ports {
+				val, err := store.Get([]byte(types.HostPrefix + name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var h map[string]interface{}
+				if err := json.Unmarshal(val, &h); err != nil {
+					t.Fatal(err)
+				}
+				if got, _ := h["port"].(float64); got != port {
+					t.Errorf("%s: expected port %v but %v", name, port, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrationsAreOrdered(t *testing.T) {
+	if err := validate(); err != nil {
+		t.Fatal(err)
+	}
+}
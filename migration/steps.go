@@ -0,0 +1,50 @@
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/types"
+)
+
+// migrations are ordered upgrade steps. Append a new step with the next version when records are changed
+// and never modify released steps.
+var migrations = []*Migration{
+	{
+		Version:     1,
+		Description: "baseline of unversioned records",
+		Migrate: func(store db.Store, batch db.Batch) ([]string, error) {
+			return nil, nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "set default ssh port 22 to hosts without port",
+		Migrate:     migrateDefaultPort,
+	},
+}
+
+// migrateDefaultPort sets port 22 to hosts imported without port.
+func migrateDefaultPort(store db.Store, batch db.Batch) ([]string, error) {
+	itr := store.NewIteratorWithPrefix([]byte(types.HostPrefix))
+	defer itr.Release()
+
+	var changes []string
+	for itr.Next() {
+		var h map[string]interface{}
+		if err := json.Unmarshal(itr.Value(), &h); err != nil {
+			return nil, fmt.Errorf("invalid host %s. %v", string(itr.Key()), err)
+		}
+		if port, ok := h["port"].(float64); ok && port != 0 {
+			continue
+		}
+		h["port"] = 22
+		encoded, err := json.Marshal(h)
+		if err != nil {
+			return nil, err
+		}
+		batch.Put(itr.Key(), encoded)
+		changes = append(changes, fmt.Sprintf("%s : port 22", string(itr.Key())))
+	}
+	return changes, itr.Error()
+}
@@ -0,0 +1,48 @@
+package remote
+
+import (
+	"errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"net"
+	"os"
+	"sync"
+)
+
+// agentForwarded is a set of clients already routing agent requests to local agent.
+var agentForwarded sync.Map
+
+// ForwardAgent routes agent requests from given session to local ssh agent(SSH_AUTH_SOCK).
+func ForwardAgent(conn *ssh.Client, session *ssh.Session) error {
+	if _, loaded := agentForwarded.LoadOrStore(conn, true); !loaded {
+		// unmark on any failure so that later sessions retry forwarding
+		if err := forwardToLocalAgent(conn); err != nil {
+			agentForwarded.Delete(conn)
+			return err
+		}
+	}
+	return agent.RequestAgentForwarding(session)
+}
+
+// forwardToLocalAgent routes agent channels of given client to local ssh agent until the client is closed.
+func forwardToLocalAgent(conn *ssh.Client) error {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return errors.New("cannot forward agent. SSH_AUTH_SOCK is empty")
+	}
+	agentConn, err := net.Dial("unix", socket)
+	if err != nil {
+		return err
+	}
+	if err := agent.ForwardToAgent(conn, agent.NewClient(agentConn)); err != nil {
+		agentConn.Close()
+		return err
+	}
+	// release resources after the connection is closed
+	go func() {
+		_ = conn.Wait()
+		agentConn.Close()
+		agentForwarded.Delete(conn)
+	}()
+	return nil
+}
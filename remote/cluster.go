@@ -0,0 +1,383 @@
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/zacscoding/myutils/types"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// partial lines such as prompts and echoes are flushed without a newline if no more output in this duration
+const clusterFlushDelay = 50 * time.Millisecond
+
+// ClusterOptions is options of cluster shell
+type ClusterOptions struct {
+	// EscapeChar starts escape sequences. 0 disables escapes.
+	EscapeChar byte
+}
+
+// clusterMember is a shell on a host in a cluster
+type clusterMember struct {
+	index   int
+	host    *types.Host
+	conn    *Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	output  *prefixWriter
+
+	mu     sync.Mutex
+	active bool
+	closed bool
+}
+
+// OpenClusterShell opens shells with a pty on given hosts and sends each keystroke to all active hosts.
+// Outputs of hosts are printed line by line with a prefix of the host name.
+// Hosts can be toggled on and off by escape sequences during the session.
+func OpenClusterShell(hosts []*types.Host, opts *ClusterOptions) error {
+	if opts == nil {
+		opts = &ClusterOptions{}
+	}
+	termFD := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(termFD) {
+		return errors.New("cluster shell requires a terminal")
+	}
+	width, height, err := terminal.GetSize(termFD)
+	if err != nil {
+		return err
+	}
+
+	out := &clusterOutput{w: os.Stdout}
+	members := connectCluster(hosts, out)
+	defer func() {
+		for _, m := range members {
+			m.conn.Close()
+		}
+	}()
+	if len(members) == 0 {
+		return errors.New("failed to connect any hosts")
+	}
+
+	termState, _ := terminal.MakeRaw(termFD)
+	defer terminal.Restore(termFD, termState)
+
+	var input io.Reader = os.Stdin
+	var escape *escapeHandler
+	if opts.EscapeChar != 0 {
+		escape = newEscapeHandler(os.Stdin, out, opts.EscapeChar, func() {
+			for _, m := range members {
+				m.conn.Close()
+			}
+		}, clusterEscapes(members)...)
+		input = escape
+	}
+
+	var waitGroup sync.WaitGroup
+	for _, m := range members {
+		if err := m.start(prefixedWidth(width, m.output.prefix), height); err != nil {
+			out.printf("[%s] failed to open a shell. %v\r\n", m.host.Name, err)
+			m.close()
+			continue
+		}
+		waitGroup.Add(1)
+		go func(m *clusterMember) {
+			defer waitGroup.Done()
+			err := waitSession(m.conn, m.session)
+			m.output.Flush()
+			m.close()
+			if err != nil && (escape == nil || !escape.Disconnected()) {
+				out.printf("[%s] session is closed. %v\r\n", m.host.Name, err)
+			} else {
+				out.printf("[%s] session is closed.\r\n", m.host.Name)
+			}
+		}(m)
+	}
+
+	stopWatch := watchTerminalResize(termFD, func(width, height int) {
+		for _, m := range members {
+			if m.session == nil {
+				continue
+			}
+			_ = m.session.WindowChange(height, prefixedWidth(width, m.output.prefix))
+		}
+	})
+	defer stopWatch()
+
+	go broadcastInput(input, members)
+
+	if opts.EscapeChar != 0 {
+		out.printf("cluster shell on %d host(s). type %c? for help.\r\n", len(members), opts.EscapeChar)
+	}
+	waitGroup.Wait()
+	return nil
+}
+
+// connectCluster connects given hosts concurrently and returns connected members in order of hosts.
+func connectCluster(hosts []*types.Host, out *clusterOutput) []*clusterMember {
+	connected := make([]*clusterMember, len(hosts))
+	var waitGroup sync.WaitGroup
+	for i, h := range hosts {
+		waitGroup.Add(1)
+		go func(i int, h *types.Host) {
+			defer waitGroup.Done()
+			conn, err := CreateSSHClient(h)
+			if err != nil {
+				out.printf("[%s] failed to connect. %v\n", h.Name, err)
+				return
+			}
+			connected[i] = &clusterMember{host: h, conn: conn, active: true}
+		}(i, h)
+	}
+	waitGroup.Wait()
+
+	var members []*clusterMember
+	for _, m := range connected {
+		if m == nil {
+			continue
+		}
+		m.index = len(members) + 1
+		m.output = newPrefixWriter(out, "["+m.host.Name+"] ")
+		members = append(members, m)
+	}
+	return members
+}
+
+// start requests a pty and starts a login shell of the member.
+// Local ssh agent is forwarded if ForwardAgent of the host is true.
+func (m *clusterMember) start(width, height int) error {
+	session, err := m.conn.NewSession()
+	if err != nil {
+		return err
+	}
+	m.session = session
+
+	if m.host.ForwardAgent {
+		if err := ForwardAgent(m.conn.Client, session); err != nil {
+			return err
+		}
+	}
+	m.stdin, err = session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	session.Stdout = m.output
+	session.Stderr = m.output
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.ECHOCTL:       0,
+		ssh.TTY_OP_ISPEED: 115200,
+		ssh.TTY_OP_OSPEED: 115200,
+	}
+	if err := session.RequestPty(termType, height, width, modes); err != nil {
+		return err
+	}
+	return session.Shell()
+}
+
+// isActive returns true if inputs are sent to the member.
+func (m *clusterMember) isActive() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active && !m.closed
+}
+
+// toggle toggles to send inputs to the member or not.
+func (m *clusterMember) toggle() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active = !m.active
+}
+
+// close marks the member closed.
+func (m *clusterMember) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+}
+
+// state returns a state of the member to display.
+func (m *clusterMember) state() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case m.closed:
+		return "closed"
+	case m.active:
+		return "on"
+	default:
+		return "off"
+	}
+}
+
+// broadcastInput reads inputs and writes them to all active members.
+func broadcastInput(r io.Reader, members []*clusterMember) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			for _, m := range members {
+				if m.isActive() {
+					_, _ = m.stdin.Write(buf[:n])
+				}
+			}
+		}
+		if err != nil {
+			for _, m := range members {
+				if m.stdin != nil {
+					_ = m.stdin.Close()
+				}
+			}
+			return
+		}
+	}
+}
+
+// clusterEscapes returns escape commands to list and toggle members.
+func clusterEscapes(members []*clusterMember) []escapeCommand {
+	list := func(e *escapeHandler) {
+		e.printf("\r\n")
+		for _, m := range members {
+			e.printf(" %d) %s [%s]\r\n", m.index, m.host.Name, m.state())
+		}
+	}
+	toggle := func(e *escapeHandler) {
+		line, err := e.readLine("toggle> ")
+		if err != nil {
+			return
+		}
+		for _, field := range strings.Fields(line) {
+			found := false
+			for _, m := range members {
+				if field == "all" || field == m.host.Name || field == strconv.Itoa(m.index) {
+					m.toggle()
+					found = true
+				}
+			}
+			if !found {
+				e.printf("unknown host %s\r\n", field)
+			}
+		}
+		list(e)
+	}
+	return []escapeCommand{
+		{key: 'l', usage: "list hosts with numbers and whether inputs are sent to them", run: list},
+		{key: 't', usage: "toggle hosts by numbers or names separated by spaces (\"all\" toggles all hosts)", run: toggle},
+	}
+}
+
+// prefixedWidth returns a width of a remote terminal excluding a prefix.
+func prefixedWidth(width int, prefix string) int {
+	if width-len(prefix) < 20 {
+		return width
+	}
+	return width - len(prefix)
+}
+
+// clusterOutput serializes outputs of members.
+// A partial line of a member stays open on the terminal until another output is written.
+type clusterOutput struct {
+	mu sync.Mutex
+	w  io.Writer
+	// open is a writer whose partial line is the last output
+	open *prefixWriter
+}
+
+// Write writes given bytes without interleaving outputs of members.
+func (o *clusterOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closeLine()
+	return o.w.Write(p)
+}
+
+func (o *clusterOutput) printf(format string, args ...interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closeLine()
+	_, _ = fmt.Fprintf(o.w, format, args...)
+}
+
+// closeLine ends an open partial line. The caller must hold the lock.
+func (o *clusterOutput) closeLine() {
+	if o.open != nil {
+		_, _ = io.WriteString(o.w, "\r\n")
+		o.open = nil
+	}
+}
+
+// prefixWriter writes lines with a prefix to cluster output.
+// A partial line such as a prompt or an echo of typing is flushed without a newline
+// if no more output in clusterFlushDelay and continued by following outputs.
+type prefixWriter struct {
+	out    *clusterOutput
+	prefix string
+
+	mu    sync.Mutex
+	buf   []byte
+	timer *time.Timer
+}
+
+func newPrefixWriter(out *clusterOutput, prefix string) *prefixWriter {
+	return &prefixWriter{out: out, prefix: prefix}
+}
+
+// Write buffers given bytes and writes complete lines.
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.write(w.buf[:i], true)
+		w.buf = w.buf[i+1:]
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	if len(w.buf) > 0 {
+		w.timer = time.AfterFunc(clusterFlushDelay, w.Flush)
+	}
+	return len(p), nil
+}
+
+// Flush writes a buffered partial line without a newline.
+func (w *prefixWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) == 0 {
+		return
+	}
+	w.write(w.buf, false)
+	w.buf = nil
+}
+
+// write writes a complete or partial line with the prefix unless continuing own open line.
+// The caller must hold the lock.
+func (w *prefixWriter) write(line []byte, complete bool) {
+	w.out.mu.Lock()
+	defer w.out.mu.Unlock()
+	if w.out.open != w {
+		w.out.closeLine()
+		_, _ = io.WriteString(w.out.w, w.prefix)
+	}
+	if complete {
+		_, _ = w.out.w.Write(bytes.TrimRight(line, "\r"))
+		_, _ = io.WriteString(w.out.w, "\r\n")
+		w.out.open = nil
+		return
+	}
+	_, _ = w.out.w.Write(line)
+	w.out.open = w
+}
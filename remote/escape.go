@@ -0,0 +1,264 @@
+package remote
+
+import (
+	"fmt"
+	"github.com/zacscoding/myutils/types"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+const escapePrompt = "ssh> "
+
+// escapeCommand is a command started by an escape character and a key.
+type escapeCommand struct {
+	key   byte
+	usage string
+	run   func(e *escapeHandler)
+}
+
+// escapeHandler handles escape sequences on the stdin stream like OpenSSH.
+// ~. (disconnect), ~? (help) and ~~ (send ~) are always supported and other commands are given.
+// Escapes are recognized only at the beginning of a line.
+type escapeHandler struct {
+	r          io.Reader
+	out        io.Writer
+	escapeChar byte
+	disconnect func()
+	commands   []escapeCommand
+
+	afterNewline bool
+	pending      bool
+	// input is the rest of the last read from r not handled yet
+	input []byte
+	// leftover is output which didn't fit in the last Read
+	leftover []byte
+	err      error
+
+	mu           sync.Mutex
+	disconnected bool
+}
+
+// newEscapeHandler returns a new escape handler reading given reader and writing messages to out.
+// disconnect is called when ~. is typed.
+func newEscapeHandler(r io.Reader, out io.Writer, escapeChar byte, disconnect func(), commands ...escapeCommand) *escapeHandler {
+	return &escapeHandler{
+		r:            r,
+		out:          out,
+		escapeChar:   escapeChar,
+		disconnect:   disconnect,
+		commands:     commands,
+		afterNewline: true,
+	}
+}
+
+// Read reads from underlying reader and returns bytes except handled escape sequences.
+// A pending escape character can make output longer than input, so the rest is kept for the next Read.
+func (e *escapeHandler) Read(p []byte) (int, error) {
+	if len(e.leftover) > 0 {
+		n := copy(p, e.leftover)
+		e.leftover = e.leftover[n:]
+		return n, nil
+	}
+	if e.err != nil {
+		return 0, e.err
+	}
+	buf := make([]byte, len(p))
+	for {
+		n, err := e.r.Read(buf)
+		e.input = buf[:n]
+		var out []byte
+		for len(e.input) > 0 {
+			b := e.input[0]
+			e.input = e.input[1:]
+			handled, ok := e.handle(b)
+			out = append(out, handled...)
+			if !ok {
+				err = io.EOF
+				break
+			}
+		}
+		written := copy(p, out)
+		e.leftover = out[written:]
+		if len(e.leftover) > 0 && err != nil {
+			e.err = err
+			return written, nil
+		}
+		if written > 0 || err != nil {
+			return written, err
+		}
+	}
+}
+
+// handle returns bytes to send given a input byte and false if disconnected.
+func (e *escapeHandler) handle(b byte) ([]byte, bool) {
+	if e.pending {
+		e.pending = false
+		switch b {
+		case '.':
+			e.mu.Lock()
+			e.disconnected = true
+			e.mu.Unlock()
+			e.printf("%c.\r\n", e.escapeChar)
+			e.disconnect()
+			return nil, false
+		case '?':
+			e.printHelp()
+			e.afterNewline = true
+			return nil, true
+		case e.escapeChar:
+			e.afterNewline = false
+			return []byte{b}, true
+		}
+		for _, c := range e.commands {
+			if c.key == b {
+				e.printf("%c%c", e.escapeChar, b)
+				c.run(e)
+				e.afterNewline = true
+				return nil, true
+			}
+		}
+		e.afterNewline = b == '\r' || b == '\n'
+		return []byte{e.escapeChar, b}, true
+	}
+	if e.afterNewline && b == e.escapeChar {
+		e.pending = true
+		return nil, true
+	}
+	e.afterNewline = b == '\r' || b == '\n'
+	return []byte{b}, true
+}
+
+// printHelp writes supported escape sequences.
+func (e *escapeHandler) printHelp() {
+	c := e.escapeChar
+	e.printf("%c?\r\nSupported escape sequences:\r\n", c)
+	e.printf(" %c.   - terminate connection\r\n", c)
+	for _, cmd := range e.commands {
+		e.printf(" %c%c   - %s\r\n", c, cmd.key, cmd.usage)
+	}
+	e.printf(" %c?   - this message\r\n", c)
+	e.printf(" %c%c   - send the escape character by typing it twice\r\n", c, c)
+	e.printf("(Note that escapes are only recognized immediately after newline.)\r\n")
+}
+
+// readLine prints a prompt and reads a line with echo from raw mode terminal.
+// Input not handled yet by Read such as a pasted command line is read first.
+// Returns an empty line if canceled by ctrl+c or esc.
+func (e *escapeHandler) readLine(prompt string) (string, error) {
+	e.printf("\r\n%s", prompt)
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if len(e.input) > 0 {
+			b[0] = e.input[0]
+			e.input = e.input[1:]
+		} else if _, err := e.r.Read(b); err != nil {
+			return "", err
+		}
+		switch b[0] {
+		case '\r', '\n':
+			e.printf("\r\n")
+			return string(line), nil
+		case 0x7f, '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				e.printf("\b \b")
+			}
+		case 0x03, 0x1b:
+			e.printf("\r\n")
+			return "", nil
+		default:
+			line = append(line, b[0])
+			_, _ = e.out.Write(b)
+		}
+	}
+}
+
+// Disconnected returns true if the connection is closed by an escape sequence.
+func (e *escapeHandler) Disconnected() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.disconnected
+}
+
+func (e *escapeHandler) printf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(e.out, format, args...)
+}
+
+// forwardEscapes opens port forwards over a connection by ~C escape.
+type forwardEscapes struct {
+	conn *Client
+
+	mu        sync.Mutex
+	listeners []net.Listener
+}
+
+// command returns ~C escape command.
+func (f *forwardEscapes) command() escapeCommand {
+	return escapeCommand{
+		key:   'C',
+		usage: "open a command line to add a port forward (-L, -R or -D)",
+		run:   f.openForward,
+	}
+}
+
+// openForward reads a forward from command line and starts it over the connection.
+func (f *forwardEscapes) openForward(e *escapeHandler) {
+	line, err := e.readLine(escapePrompt)
+	if err != nil {
+		return
+	}
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	forward, err := parseForwardCommand(line)
+	if err != nil {
+		e.printf("%v\r\n", err)
+		return
+	}
+	listener, err := StartForward(f.conn.Client, forward)
+	if err != nil {
+		e.printf("failed to start forward %v. %v\r\n", forward, err)
+		return
+	}
+	f.mu.Lock()
+	f.listeners = append(f.listeners, listener)
+	f.mu.Unlock()
+	e.printf("Forwarding %v\r\n", forward)
+}
+
+// parseForwardCommand parses a forward typed in ~C command line like "-L 8080:host:80" or "-L8080:host:80".
+func parseForwardCommand(line string) (*types.Forward, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 1 && len(fields[0]) > 2 {
+		fields = []string{fields[0][:2], fields[0][2:]}
+	}
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("usage: -L[bind_address:]port:host:hostport | -R[bind_address:]port:host:hostport | -D[bind_address:]port")
+	}
+
+	var forwardType string
+	switch fields[0] {
+	case "-L":
+		forwardType = types.ForwardLocal
+	case "-R":
+		forwardType = types.ForwardRemote
+	case "-D":
+		forwardType = types.ForwardDynamic
+	default:
+		return nil, fmt.Errorf("unknown forward %s", fields[0])
+	}
+	return ParseForward(forwardType, fields[1])
+}
+
+// Close stops forwards opened by escape sequences.
+func (f *forwardEscapes) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, l := range f.listeners {
+		_ = l.Close()
+	}
+	f.listeners = nil
+}
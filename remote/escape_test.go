@@ -0,0 +1,125 @@
+package remote
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEscapeHandler(t *testing.T) {
+	cases := []struct {
+		name         string
+		input        string
+		output       string
+		disconnected bool
+		commands     string
+	}{
+		{name: "plain", input: "ls\r", output: "ls\r"},
+		{name: "double escape sends escape", input: "~~x\r", output: "~x\r"},
+		{name: "escape only after newline", input: "a~.\r", output: "a~.\r"},
+		{name: "unknown escape is sent", input: "~x\r", output: "~x\r"},
+		{name: "disconnect", input: "ls\r~.more", output: "ls\r", disconnected: true},
+		{name: "help is not sent", input: "~?ls\r", output: "ls\r"},
+		{name: "custom command", input: "~l\r~la", output: "\ra", commands: "ll"},
+		{name: "pending escape at buffer end", input: "~x~y", output: "~x~y"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var commands string
+			disconnected := false
+			e := newEscapeHandler(bytes.NewBufferString(c.input), ioutil.Discard, '~', func() {
+				disconnected = true
+			}, escapeCommand{key: 'l', usage: "list", run: func(e *escapeHandler) {
+				commands += "l"
+			}})
+			out, err := ioutil.ReadAll(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != c.output {
+				t.Errorf("expected output %q but %q", c.output, out)
+			}
+			if disconnected != c.disconnected || e.Disconnected() != c.disconnected {
+				t.Errorf("expected disconnected %v but %v", c.disconnected, disconnected)
+			}
+			if commands != c.commands {
+				t.Errorf("expected commands %q but %q", c.commands, commands)
+			}
+		})
+	}
+}
+
+// TestEscapeHandlerSmallReads checks an escape character pending from a previous read
+// is not dropped when the next read fills the buffer.
+func TestEscapeHandlerSmallReads(t *testing.T) {
+	input := "~xy\r~zw"
+	e := newEscapeHandler(iotest.OneByteReader(bytes.NewBufferString(input)), ioutil.Discard, '~', func() {})
+	var out []byte
+	p := make([]byte, 1)
+	for {
+		n, err := e.Read(p)
+		out = append(out, p[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if string(out) != input {
+		t.Errorf("expected %q but %q", input, out)
+	}
+}
+
+// TestEscapeHandlerReadLine checks a command line pasted with its escape is read by the command, not sent.
+func TestEscapeHandlerReadLine(t *testing.T) {
+	var line string
+	e := newEscapeHandler(bytes.NewBufferString("~C-L8080:h:80\rls\r"), ioutil.Discard, '~', func() {}, escapeCommand{
+		key: 'C',
+		run: func(e *escapeHandler) {
+			line, _ = e.readLine(escapePrompt)
+		},
+	})
+	out, err := ioutil.ReadAll(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "-L8080:h:80" || string(out) != "ls\r" {
+		t.Errorf("expected line %q and output %q but %q and %q", "-L8080:h:80", "ls\r", line, out)
+	}
+}
+
+func TestParseForwardCommand(t *testing.T) {
+	cases := []struct {
+		line   string
+		listen string
+		target string
+		fail   bool
+	}{
+		{line: "-L 8080:h:80", listen: "localhost:8080", target: "h:80"},
+		{line: "-L8080:h:80", listen: "localhost:8080", target: "h:80"},
+		{line: " -R 9000:localhost:22 ", listen: "localhost:9000", target: "localhost:22"},
+		{line: "-D1080", listen: "localhost:1080"},
+		{line: "-L", fail: true},
+		{line: "-X8080:h:80", fail: true},
+		{line: "-L 8080:h:80 extra", fail: true},
+	}
+	for _, c := range cases {
+		f, err := parseForwardCommand(c.line)
+		if c.fail {
+			if err == nil {
+				t.Errorf("%q: expected an error but %v", c.line, f)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.line, err)
+			continue
+		}
+		if f.Listen != c.listen || f.Target != c.target {
+			t.Errorf("%q: expected listen %s, target %s but %v", c.line, c.listen, c.target, f)
+		}
+	}
+}
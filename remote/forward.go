@@ -0,0 +1,266 @@
+package remote
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/zacscoding/myutils/types"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultBindAddress = "localhost"
+
+// ParseForward returns a forward given type and ssh option format spec.
+// local and remote spec is [bind_address:]port:host:hostport and dynamic spec is [bind_address:]port.
+func ParseForward(forwardType, spec string) (*types.Forward, error) {
+	fields := splitForwardSpec(spec)
+	f := &types.Forward{Type: forwardType}
+
+	switch forwardType {
+	case types.ForwardLocal, types.ForwardRemote:
+		switch len(fields) {
+		case 3:
+			f.Listen = net.JoinHostPort(defaultBindAddress, fields[0])
+			f.Target = net.JoinHostPort(fields[1], fields[2])
+		case 4:
+			f.Listen = net.JoinHostPort(fields[0], fields[1])
+			f.Target = net.JoinHostPort(fields[2], fields[3])
+		default:
+			return nil, fmt.Errorf("invalid %s forward : %s", forwardType, spec)
+		}
+	case types.ForwardDynamic:
+		switch len(fields) {
+		case 1:
+			f.Listen = net.JoinHostPort(defaultBindAddress, fields[0])
+		case 2:
+			f.Listen = net.JoinHostPort(fields[0], fields[1])
+		default:
+			return nil, fmt.Errorf("invalid %s forward : %s", forwardType, spec)
+		}
+	default:
+		return nil, fmt.Errorf("unknown forward type : %s", forwardType)
+	}
+
+	if err := validateAddress(f.Listen); err != nil {
+		return nil, err
+	}
+	if f.Target != "" {
+		if err := validateAddress(f.Target); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// splitForwardSpec splits given spec with ':' except in brackets i.e [::1]:8080
+func splitForwardSpec(spec string) []string {
+	var (
+		fields   []string
+		start    int
+		brackets bool
+	)
+	for i, c := range spec {
+		switch c {
+		case '[':
+			brackets = true
+		case ']':
+			brackets = false
+		case ':':
+			if !brackets {
+				fields = append(fields, strings.Trim(spec[start:i], "[]"))
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, strings.Trim(spec[start:], "[]"))
+}
+
+// validateAddress returns an error if given address doesn't have a valid port.
+func validateAddress(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		return fmt.Errorf("invalid port : %s", addr)
+	}
+	return nil
+}
+
+// StartForward starts to listen a given forward over ssh client and returns a listener.
+// Closing the listener stops the forward.
+func StartForward(conn *ssh.Client, f *types.Forward) (net.Listener, error) {
+	var (
+		listener net.Listener
+		err      error
+		dial     func(src net.Conn) (net.Conn, error)
+	)
+
+	switch f.Type {
+	case types.ForwardLocal:
+		listener, err = net.Listen("tcp", f.Listen)
+		dial = func(net.Conn) (net.Conn, error) {
+			return conn.Dial("tcp", f.Target)
+		}
+	case types.ForwardRemote:
+		listener, err = conn.Listen("tcp", f.Listen)
+		dial = func(net.Conn) (net.Conn, error) {
+			return net.Dial("tcp", f.Target)
+		}
+	case types.ForwardDynamic:
+		listener, err = net.Listen("tcp", f.Listen)
+		dial = func(src net.Conn) (net.Conn, error) {
+			return socks5Connect(src, conn)
+		}
+	default:
+		return nil, fmt.Errorf("unknown forward type : %s", f.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			src, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer src.Close()
+				dest, err := dial(src)
+				if err != nil {
+					log.Printf("failed to forward %v. %v\n", f, err)
+					return
+				}
+				defer dest.Close()
+				pipe(src, dest)
+			}()
+		}
+	}()
+	return listener, nil
+}
+
+// pipe copies data between given connections until either is closed.
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyFn := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		// close write side if possible, so that the other side can finish
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+	}
+	go copyFn(a, b)
+	go copyFn(b, a)
+	wg.Wait()
+}
+
+// socks5 protocol constants. See RFC 1928
+const (
+	socks5Version       = 0x05
+	socks5NoAuth        = 0x00
+	socks5NoAcceptable  = 0xff
+	socks5CmdConnect    = 0x01
+	socks5AddrIPv4      = 0x01
+	socks5AddrDomain    = 0x03
+	socks5AddrIPv6      = 0x04
+	socks5Succeeded     = 0x00
+	socks5Failure       = 0x01
+	socks5CmdNotSupport = 0x07
+)
+
+// socks5Connect handles a socks5 handshake of given client and returns a connection
+// to the requested address through ssh client. Only no authentication and CONNECT are supported.
+func socks5Connect(client net.Conn, conn *ssh.Client) (net.Conn, error) {
+	// greeting : version, number of methods, methods
+	buf := make([]byte, 258)
+	if _, err := io.ReadFull(client, buf[:2]); err != nil {
+		return nil, err
+	}
+	if buf[0] != socks5Version {
+		return nil, fmt.Errorf("unsupported socks version %d", buf[0])
+	}
+	methods := buf[2 : 2+int(buf[1])]
+	if _, err := io.ReadFull(client, methods); err != nil {
+		return nil, err
+	}
+	hasNoAuth := false
+	for _, m := range methods {
+		if m == socks5NoAuth {
+			hasNoAuth = true
+		}
+	}
+	if !hasNoAuth {
+		_, _ = client.Write([]byte{socks5Version, socks5NoAcceptable})
+		return nil, errors.New("socks client doesn't support no authentication")
+	}
+	if _, err := client.Write([]byte{socks5Version, socks5NoAuth}); err != nil {
+		return nil, err
+	}
+
+	// request : version, command, reserved, address type, address, port
+	if _, err := io.ReadFull(client, buf[:4]); err != nil {
+		return nil, err
+	}
+	if buf[1] != socks5CmdConnect {
+		_ = socks5Reply(client, socks5CmdNotSupport)
+		return nil, fmt.Errorf("unsupported socks command %d", buf[1])
+	}
+
+	var host string
+	switch buf[3] {
+	case socks5AddrIPv4:
+		if _, err := io.ReadFull(client, buf[:net.IPv4len]); err != nil {
+			return nil, err
+		}
+		host = net.IP(buf[:net.IPv4len]).String()
+	case socks5AddrIPv6:
+		if _, err := io.ReadFull(client, buf[:net.IPv6len]); err != nil {
+			return nil, err
+		}
+		host = net.IP(buf[:net.IPv6len]).String()
+	case socks5AddrDomain:
+		if _, err := io.ReadFull(client, buf[:1]); err != nil {
+			return nil, err
+		}
+		length := int(buf[0])
+		if _, err := io.ReadFull(client, buf[:length]); err != nil {
+			return nil, err
+		}
+		host = string(buf[:length])
+	default:
+		_ = socks5Reply(client, socks5Failure)
+		return nil, fmt.Errorf("unsupported socks address type %d", buf[3])
+	}
+	if _, err := io.ReadFull(client, buf[:2]); err != nil {
+		return nil, err
+	}
+	port := binary.BigEndian.Uint16(buf[:2])
+
+	dest, err := conn.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		_ = socks5Reply(client, socks5Failure)
+		return nil, err
+	}
+	if err := socks5Reply(client, socks5Succeeded); err != nil {
+		dest.Close()
+		return nil, err
+	}
+	return dest, nil
+}
+
+// socks5Reply writes a reply with given status and unspecified bound address.
+func socks5Reply(client net.Conn, status byte) error {
+	_, err := client.Write([]byte{socks5Version, status, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
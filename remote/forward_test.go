@@ -0,0 +1,43 @@
+package remote
+
+import (
+	"github.com/zacscoding/myutils/types"
+	"testing"
+)
+
+func TestParseForward(t *testing.T) {
+	cases := []struct {
+		forwardType string
+		spec        string
+		listen      string
+		target      string
+		fail        bool
+	}{
+		{forwardType: types.ForwardLocal, spec: "8080:db:5432", listen: "localhost:8080", target: "db:5432"},
+		{forwardType: types.ForwardLocal, spec: "0.0.0.0:8080:db:5432", listen: "0.0.0.0:8080", target: "db:5432"},
+		{forwardType: types.ForwardRemote, spec: "[::1]:9000:[fe80::1]:22", listen: "[::1]:9000", target: "[fe80::1]:22"},
+		{forwardType: types.ForwardDynamic, spec: "1080", listen: "localhost:1080"},
+		{forwardType: types.ForwardDynamic, spec: "127.0.0.1:1080", listen: "127.0.0.1:1080"},
+		{forwardType: types.ForwardLocal, spec: "8080:db", fail: true},
+		{forwardType: types.ForwardLocal, spec: "8080:db:70000", fail: true},
+		{forwardType: types.ForwardLocal, spec: "port:db:5432", fail: true},
+		{forwardType: types.ForwardDynamic, spec: "a:b:1080", fail: true},
+		{forwardType: "unknown", spec: "1080", fail: true},
+	}
+	for _, c := range cases {
+		f, err := ParseForward(c.forwardType, c.spec)
+		if c.fail {
+			if err == nil {
+				t.Errorf("%s %s: expected an error but %v", c.forwardType, c.spec, f)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: %v", c.forwardType, c.spec, err)
+			continue
+		}
+		if f.Type != c.forwardType || f.Listen != c.listen || f.Target != c.target {
+			t.Errorf("%s %s: expected listen %s, target %s but %v", c.forwardType, c.spec, c.listen, c.target, f)
+		}
+	}
+}
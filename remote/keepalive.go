@@ -0,0 +1,137 @@
+package remote
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultKeepAliveInterval  = 30 * time.Second
+	DefaultKeepAliveMaxMissed = 3
+	keepAliveRequest          = "keepalive@openssh.com"
+)
+
+// KeepAliveError is an error if a server doesn't reply keepalive requests.
+type KeepAliveError struct {
+	Addr     string
+	Missed   int
+	Interval time.Duration
+}
+
+func (e *KeepAliveError) Error() string {
+	return fmt.Sprintf("connection to %s is closed. no response for %d keepalive requests (interval %v)",
+		e.Addr, e.Missed, e.Interval)
+}
+
+// Client is a ssh client which sends keepalive requests and closes the connection
+// if the server doesn't reply them.
+type Client struct {
+	*ssh.Client
+
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	err       error
+}
+
+// newClient returns a new client and starts keepalive if interval is greater than zero.
+func newClient(conn *ssh.Client, interval time.Duration, maxMissed int) *Client {
+	c := &Client{
+		Client: conn,
+		done:   make(chan struct{}),
+	}
+	if interval > 0 {
+		go c.keepAlive(interval, maxMissed)
+	}
+	return c
+}
+
+// Err returns a KeepAliveError if the connection is closed by missed keepalives, otherwise nil.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Wait blocks until the connection has shut down and returns KeepAliveError if closed by keepalive.
+func (c *Client) Wait() error {
+	err := c.Client.Wait()
+	if kerr := c.Err(); kerr != nil {
+		return kerr
+	}
+	return err
+}
+
+// Close stops keepalive and closes the connection.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return c.Client.Close()
+}
+
+// keepAlive sends keepalive requests every interval and closes the connection
+// if missed replies are reached to maxMissed.
+func (c *Client) keepAlive(interval time.Duration, maxMissed int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	missed := 0
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		if sendKeepAlive(c.Client, interval) {
+			missed = 0
+			continue
+		}
+		missed++
+		if missed < maxMissed {
+			continue
+		}
+		c.mu.Lock()
+		c.err = &KeepAliveError{
+			Addr:     c.RemoteAddr().String(),
+			Missed:   missed,
+			Interval: interval,
+		}
+		c.mu.Unlock()
+		_ = c.Close()
+		return
+	}
+}
+
+// sendKeepAlive returns true if the server replies a keepalive request within timeout.
+// Any reply including failure means the server is alive.
+func sendKeepAlive(conn *ssh.Client, timeout time.Duration) bool {
+	replied := make(chan error, 1)
+	go func() {
+		_, _, err := conn.SendRequest(keepAliveRequest, true, nil)
+		replied <- err
+	}()
+
+	select {
+	case err := <-replied:
+		return err == nil
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// keepAliveOptions returns keepalive interval and max missed given host options.
+// Zero values use defaults and negative interval disables keepalive.
+func keepAliveOptions(interval, maxMissed int) (time.Duration, int) {
+	d := time.Duration(interval) * time.Second
+	if interval == 0 {
+		d = DefaultKeepAliveInterval
+	}
+	if maxMissed <= 0 {
+		maxMissed = DefaultKeepAliveMaxMissed
+	}
+	return d, maxMissed
+}
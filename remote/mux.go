@@ -0,0 +1,455 @@
+package remote
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zacscoding/myutils/types"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MuxSocketPath is a unix socket path of multiplexing daemon.
+// If not empty, CreateSSHClient opens connections over the daemon if it is running.
+var MuxSocketPath string
+
+// commands of multiplexing daemon
+const (
+	MuxCommandConnect  = "connect"
+	MuxCommandStatus   = "status"
+	MuxCommandShutdown = "shutdown"
+)
+
+const (
+	DefaultMuxIdleTimeout = 10 * time.Minute
+	muxRequestTimeout     = 10 * time.Second
+)
+
+// MuxRequest is a first line of a connection to multiplexing daemon.
+// After a connect request, ssh protocol is started over the connection.
+// Only a name of the host is sent and the daemon loads the host itself, so credentials are not sent over the socket.
+type MuxRequest struct {
+	Command string `json:"command"`
+	Host    string `json:"host,omitempty"`
+}
+
+// MuxStatus is a status of a connection kept by multiplexing daemon.
+type MuxStatus struct {
+	Host      string    `json:"host"`
+	Address   string    `json:"address"`
+	Clients   int       `json:"clients"`
+	Connected time.Time `json:"connected"`
+	LastUsed  time.Time `json:"lastUsed"`
+}
+
+// MuxServer keeps ssh connections per host and serves sessions over them to local clients.
+type MuxServer struct {
+	IdleTimeout time.Duration
+
+	config   *ssh.ServerConfig
+	loadHost func(name string) (*types.Host, error)
+	mu       sync.Mutex
+	conns    map[string]*muxConn
+}
+
+// muxConn is a upstream connection shared by local clients.
+type muxConn struct {
+	key       string
+	host      *types.Host
+	client    *Client
+	clients   int
+	connected time.Time
+	lastUsed  time.Time
+	idleTimer *time.Timer
+}
+
+// NewMuxServer returns a new multiplexing server with given idle timeout of connections.
+// loadHost returns a host requested by a local client.
+func NewMuxServer(idleTimeout time.Duration, loadHost func(name string) (*types.Host, error)) (*MuxServer, error) {
+	// local clients are trusted by permission of the unix socket
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultMuxIdleTimeout
+	}
+	return &MuxServer{
+		IdleTimeout: idleTimeout,
+		config:      config,
+		loadHost:    loadHost,
+		conns:       make(map[string]*muxConn),
+	}, nil
+}
+
+// Serve listens given unix socket and serves local clients until shutdown.
+func (s *MuxServer) Serve(socketPath string) error {
+	if _, err := SendMuxRequest(socketPath, &MuxRequest{Command: MuxCommandStatus}); err == nil {
+		return errors.New("multiplexing daemon is already running")
+	}
+	// remove a stale socket
+	_ = os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		return err
+	}
+	log.Println("multiplexing daemon is listening :", socketPath)
+
+	shutdown := make(chan struct{})
+	var shutdownOnce sync.Once
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-shutdown:
+				s.closeAll()
+				log.Println("multiplexing daemon is stopped")
+				return nil
+			default:
+				return err
+			}
+		}
+		go func() {
+			if s.handle(conn) {
+				shutdownOnce.Do(func() {
+					close(shutdown)
+					listener.Close()
+				})
+			}
+		}()
+	}
+}
+
+// handle handles a local connection and returns true if requested to shutdown.
+func (s *MuxServer) handle(conn net.Conn) bool {
+	_ = conn.SetDeadline(time.Now().Add(muxRequestTimeout))
+	req, err := readMuxRequest(conn)
+	if err != nil {
+		conn.Close()
+		return false
+	}
+
+	switch req.Command {
+	case MuxCommandConnect:
+		_ = conn.SetDeadline(time.Time{})
+		s.serveClient(conn, req.Host)
+		return false
+	case MuxCommandStatus, MuxCommandShutdown:
+		defer conn.Close()
+		_ = json.NewEncoder(conn).Encode(s.Statuses())
+		return req.Command == MuxCommandShutdown
+	default:
+		conn.Close()
+		return false
+	}
+}
+
+// serveClient proxies channels of a local client to the upstream connection of given host.
+func (s *MuxServer) serveClient(conn net.Conn, hostname string) {
+	defer conn.Close()
+	if hostname == "" {
+		return
+	}
+	h, err := s.loadHost(hostname)
+	if err != nil {
+		log.Printf("failed to load a host %s. %v\n", hostname, err)
+		return
+	}
+	mc, err := s.acquire(h)
+	if err != nil {
+		log.Printf("failed to connect to %s. %v\n", h.Name, err)
+		return
+	}
+	defer s.release(mc)
+
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		return
+	}
+	defer sconn.Close()
+
+	go func() {
+		for req := range reqs {
+			// keepalive is replied by daemon and other global requests i.e remote forwards
+			// are not supported because replies of upstream cannot be routed to a client.
+			if req.WantReply {
+				_ = req.Reply(req.Type == keepAliveRequest, nil)
+			}
+		}
+	}()
+
+	for nc := range chans {
+		go proxyChannel(nc, mc.client.Client)
+	}
+}
+
+// proxyChannel opens a same channel to upstream and copies data and requests between them.
+func proxyChannel(nc ssh.NewChannel, upstream *ssh.Client) {
+	upCh, upReqs, err := upstream.OpenChannel(nc.ChannelType(), nc.ExtraData())
+	if err != nil {
+		if openErr, ok := err.(*ssh.OpenChannelError); ok {
+			_ = nc.Reject(openErr.Reason, openErr.Message)
+		} else {
+			_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+		}
+		return
+	}
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		upCh.Close()
+		return
+	}
+
+	var outputs sync.WaitGroup
+	outputs.Add(2)
+	go func() {
+		defer outputs.Done()
+		_, _ = io.Copy(ch, upCh)
+		_ = ch.CloseWrite()
+	}()
+	go func() {
+		defer outputs.Done()
+		_, _ = io.Copy(ch.Stderr(), upCh.Stderr())
+	}()
+	go func() {
+		_, _ = io.Copy(upCh, ch)
+		_ = upCh.CloseWrite()
+	}()
+	go func() {
+		for req := range reqs {
+			ok, err := upCh.SendRequest(req.Type, req.WantReply, req.Payload)
+			if req.WantReply {
+				_ = req.Reply(ok && err == nil, nil)
+			}
+		}
+		upCh.Close()
+	}()
+
+	for req := range upReqs {
+		ok, err := ch.SendRequest(req.Type, req.WantReply, req.Payload)
+		if req.WantReply {
+			_ = req.Reply(ok && err == nil, nil)
+		}
+	}
+	// upstream channel is closed, so close the local channel after flushing outputs
+	outputs.Wait()
+	ch.Close()
+}
+
+// acquire returns a upstream connection of given host and dials if not exist.
+func (s *MuxServer) acquire(h *types.Host) (*muxConn, error) {
+	key := muxKey(h)
+
+	s.mu.Lock()
+	mc, ok := s.conns[key]
+	if ok {
+		mc.clients++
+		mc.lastUsed = time.Now()
+		if mc.idleTimer != nil {
+			mc.idleTimer.Stop()
+			mc.idleTimer = nil
+		}
+		s.mu.Unlock()
+		return mc, nil
+	}
+	s.mu.Unlock()
+
+	client, err := DialSSHClient(h)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("connected to %s(%s)\n", h.Name, client.RemoteAddr())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// other client may connect concurrently
+	if other, ok := s.conns[key]; ok {
+		client.Close()
+		other.clients++
+		other.lastUsed = time.Now()
+		return other, nil
+	}
+	mc = &muxConn{
+		key:       key,
+		host:      h,
+		client:    client,
+		clients:   1,
+		connected: time.Now(),
+		lastUsed:  time.Now(),
+	}
+	s.conns[key] = mc
+
+	go func() {
+		err := client.Wait()
+		log.Printf("disconnected from %s. %v\n", h.Name, err)
+		s.remove(mc)
+	}()
+	return mc, nil
+}
+
+// release decreases clients of given connection and closes it after idle timeout if no clients.
+func (s *MuxServer) release(mc *muxConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mc.clients--
+	mc.lastUsed = time.Now()
+	if mc.clients > 0 {
+		return
+	}
+	mc.idleTimer = time.AfterFunc(s.IdleTimeout, func() {
+		s.mu.Lock()
+		if mc.clients > 0 {
+			s.mu.Unlock()
+			return
+		}
+		// remove before closing so that a new client doesn't acquire the closing connection
+		if s.conns[mc.key] == mc {
+			delete(s.conns, mc.key)
+		}
+		s.mu.Unlock()
+		log.Printf("close idle connection to %s\n", mc.host.Name)
+		mc.client.Close()
+	})
+}
+
+// remove removes given connection from the pool.
+func (s *MuxServer) remove(mc *muxConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conns[mc.key] == mc {
+		delete(s.conns, mc.key)
+	}
+}
+
+// closeAll closes all upstream connections.
+func (s *MuxServer) closeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, mc := range s.conns {
+		mc.client.Close()
+	}
+}
+
+// Statuses returns statuses of upstream connections sorted by host name.
+func (s *MuxServer) Statuses() []MuxStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]MuxStatus, 0, len(s.conns))
+	for _, mc := range s.conns {
+		statuses = append(statuses, MuxStatus{
+			Host:      mc.host.Name,
+			Address:   mc.client.RemoteAddr().String(),
+			Clients:   mc.clients,
+			Connected: mc.connected,
+			LastUsed:  mc.lastUsed,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Host < statuses[j].Host
+	})
+	return statuses
+}
+
+// SendMuxRequest sends a status or shutdown request to multiplexing daemon.
+func SendMuxRequest(socketPath string, req *MuxRequest) ([]MuxStatus, error) {
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(muxRequestTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var statuses []MuxStatus
+	if err := json.NewDecoder(conn).Decode(&statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// dialMux returns a ssh client over multiplexing daemon given host.
+func dialMux(socketPath string, h *types.Host) (*ssh.Client, error) {
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	// the daemon may wait for the local store and dial the host before the handshake
+	_ = conn.SetDeadline(time.Now().Add(muxRequestTimeout + dialTimeout))
+	if err := json.NewEncoder(conn).Encode(&MuxRequest{Command: MuxCommandConnect, Host: h.Name}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            h.Name,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         dialTimeout,
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, socketPath, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot connect to %s over multiplexing daemon. %v", h.Name, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// readMuxRequest reads a json line without reading after it,
+// because the rest of the connection is used by ssh protocol.
+func readMuxRequest(conn net.Conn) (*MuxRequest, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := conn.Read(b); err != nil {
+			return nil, err
+		}
+		if b[0] == '\n' {
+			break
+		}
+		line = append(line, b[0])
+		if len(line) > bufio.MaxScanTokenSize {
+			return nil, errors.New("too long request")
+		}
+	}
+	var req MuxRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// muxKey returns a key of upstream connections given host.
+// A updated host has a different key, so doesn't reuse a connection of old one.
+func muxKey(h *types.Host) string {
+	b, _ := json.Marshal(h)
+	sum := sha256.Sum256(b)
+	return h.Name + "." + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+// +build !windows
+
+package remote
+
+import (
+	"golang.org/x/crypto/ssh/terminal"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchTerminalResize calls onResize with a new size whenever receives SIGWINCH.
+// Returns a function to stop watching.
+func watchTerminalResize(fd int, onResize func(width, height int)) func() {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, syscall.SIGWINCH)
+
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				width, height, err := terminal.GetSize(fd)
+				if err != nil {
+					continue
+				}
+				onResize(width, height)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
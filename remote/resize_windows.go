@@ -0,0 +1,38 @@
+package remote
+
+import (
+	"golang.org/x/crypto/ssh/terminal"
+	"time"
+)
+
+// resizePollInterval is a interval to check a console size because windows doesn't have SIGWINCH.
+const resizePollInterval = 500 * time.Millisecond
+
+// watchTerminalResize calls onResize with a new size whenever a console size is changed.
+// Returns a function to stop watching.
+func watchTerminalResize(fd int, onResize func(width, height int)) func() {
+	done := make(chan struct{})
+	width, height, _ := terminal.GetSize(fd)
+
+	go func() {
+		ticker := time.NewTicker(resizePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w, h, err := terminal.GetSize(fd)
+				if err != nil || (w == width && h == height) {
+					continue
+				}
+				width, height = w, h
+				onResize(width, height)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
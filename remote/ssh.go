@@ -3,27 +3,53 @@ package remote
 import (
 	"bytes"
 	"github.com/shiena/ansicolor"
+	"github.com/zacscoding/myutils/cast"
 	"github.com/zacscoding/myutils/types"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/terminal"
+	"io"
 	"io/ioutil"
 	"os"
 	"strconv"
 	"sync"
+	"time"
+)
+
+const (
+	termType          = "xterm-256color"
+	defaultTermWidth  = 80
+	defaultTermHeight = 24
+	dialTimeout       = 15 * time.Second
 )
 
 type HostCmdResult struct {
-	Host    *types.Host
-	Command string
-	Result  *types.ExecuteResult
-	Err     error
+	Host     *types.Host
+	Command  string
+	Result   *types.ExecuteResult
+	Err      error
+	Duration time.Duration
 }
 
 type CommandGenerator func(h *types.Host) string
 type CommandHandler func(result HostCmdResult)
 
-// CreateSSHClient create ssh client given a host
-func CreateSSHClient(h *types.Host) (*ssh.Client, error) {
+// CreateSSHClient create ssh client given a host.
+// If multiplexing daemon is running, the client opens sessions over a connection kept by the daemon
+// except agent forwarding which requires an own connection. Otherwise dials the host directly.
+func CreateSSHClient(h *types.Host) (*Client, error) {
+	if MuxSocketPath != "" && !h.ForwardAgent {
+		if conn, err := dialMux(MuxSocketPath, h); err == nil {
+			// keepalive of the host is sent by the daemon
+			return newClient(conn, 0, 0), nil
+		}
+	}
+	return DialSSHClient(h)
+}
+
+// DialSSHClient dials ssh client given a host.
+// The client sends keepalive requests configured by the host and closes the connection
+// if the server doesn't reply them.
+func DialSSHClient(h *types.Host) (*Client, error) {
 	var auth ssh.AuthMethod
 	if h.Password != "" {
 		auth = ssh.Password(h.Password)
@@ -33,6 +59,9 @@ func CreateSSHClient(h *types.Host) (*ssh.Client, error) {
 			return nil, err
 		}
 		key, err := ssh.ParsePrivateKey(pemBytes)
+		if err != nil {
+			return nil, err
+		}
 		auth = ssh.PublicKeys(key)
 	}
 
@@ -42,23 +71,55 @@ func CreateSSHClient(h *types.Host) (*ssh.Client, error) {
 			auth,
 		},
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         dialTimeout,
 	}
 
 	addr := h.Address + ":" + strconv.Itoa(h.Port)
-	return ssh.Dial("tcp", addr, config)
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	interval, maxMissed := keepAliveOptions(h.KeepAlive, h.KeepAliveMaxMissed)
+	return newClient(conn, interval, maxMissed), nil
+}
+
+// ShellOptions is options of remote shell
+type ShellOptions struct {
+	// Recorder records outputs of the shell if not nil
+	Recorder *cast.Recorder
+	// ForwardAgent forwards local ssh agent to the shell
+	ForwardAgent bool
+	// Command is executed with a pty instead of a login shell if not empty
+	Command string
+	// EscapeChar starts escape sequences like ~. to disconnect if the shell has a pty. 0 disables escapes.
+	EscapeChar byte
 }
 
-// OpenRemoteShell start to open remote shell
-func OpenRemoteShell(conn *ssh.Client) error {
+// OpenRemoteShell start to open remote shell.
+// Returns *ssh.ExitError if the shell or command exits with non zero status.
+func OpenRemoteShell(conn *Client, opts *ShellOptions) error {
+	if opts == nil {
+		opts = &ShellOptions{}
+	}
 	session, err := conn.NewSession()
 	if err != nil {
 		return err
 	}
 	defer session.Close()
 
+	if opts.ForwardAgent {
+		if err := ForwardAgent(conn.Client, session); err != nil {
+			return err
+		}
+	}
+
 	session.Stdin = os.Stdin
 	session.Stdout = ansicolor.NewAnsiColorWriter(os.Stdout)
 	session.Stderr = ansicolor.NewAnsiColorWriter(os.Stderr)
+	if opts.Recorder != nil {
+		session.Stdout = io.MultiWriter(session.Stdout, opts.Recorder)
+		session.Stderr = io.MultiWriter(session.Stderr, opts.Recorder)
+	}
 
 	// copy from http://talks.rodaine.com/gosf-ssh/present.slide#9
 	modes := ssh.TerminalModes{
@@ -69,31 +130,89 @@ func OpenRemoteShell(conn *ssh.Client) error {
 	}
 
 	termFD := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(termFD) {
+		// stdin is not a terminal i.e pipe or file, so run a shell in line mode without pty
+		if opts.Recorder != nil {
+			if err := opts.Recorder.Start(defaultTermWidth, defaultTermHeight, nil); err != nil {
+				return err
+			}
+		}
+		err = startShell(session, opts.Command)
+		if err != nil {
+			return err
+		}
+		return waitSession(conn, session)
+	}
 
 	width, height, err := terminal.GetSize(termFD)
 	if err != nil {
 		return err
 	}
 
+	if opts.Recorder != nil {
+		env := map[string]string{"TERM": termType}
+		if err := opts.Recorder.Start(width, height, env); err != nil {
+			return err
+		}
+	}
+
 	termState, _ := terminal.MakeRaw(termFD)
 	defer terminal.Restore(termFD, termState)
 
-	err = session.RequestPty("xterm-256color", height, width, modes)
-	if err != nil {
-		return err
+	var escape *escapeHandler
+	if opts.EscapeChar != 0 {
+		forwards := &forwardEscapes{conn: conn}
+		defer forwards.Close()
+		escape = newEscapeHandler(os.Stdin, os.Stdout, opts.EscapeChar, func() {
+			_ = conn.Close()
+		}, forwards.command())
+		session.Stdin = escape
 	}
-	err = session.Shell()
+
+	err = session.RequestPty(termType, height, width, modes)
 	if err != nil {
 		return err
 	}
-	err = session.Wait()
+
+	stopWatch := watchTerminalResize(termFD, func(width, height int) {
+		_ = session.WindowChange(height, width)
+		if opts.Recorder != nil {
+			_ = opts.Recorder.Resize(width, height)
+		}
+	})
+	defer stopWatch()
+
+	err = startShell(session, opts.Command)
 	if err != nil {
 		return err
 	}
-	return nil
+	err = waitSession(conn, session)
+	if escape != nil && escape.Disconnected() {
+		// closed by ~. escape
+		return nil
+	}
+	return err
+}
+
+// waitSession waits a session and returns KeepAliveError if the connection is closed by keepalive.
+func waitSession(conn *Client, session *ssh.Session) error {
+	err := session.Wait()
+	if kerr := conn.Err(); kerr != nil {
+		return kerr
+	}
+	return err
 }
 
-// executesCommand execute command to given hosts with go routines
+// startShell starts a given command or a login shell if command is empty.
+func startShell(session *ssh.Session, command string) error {
+	if command == "" {
+		return session.Shell()
+	}
+	return session.Start(command)
+}
+
+// executesCommand execute command to given hosts with go routines.
+// Returns after handler is called for all hosts. Result.Error is *ssh.ExitError if the command exits with non zero status.
 func ExecutesCommand(hosts []*types.Host, commandGen CommandGenerator, handler CommandHandler) {
 	var waitGroup sync.WaitGroup
 	waitGroup.Add(len(hosts))
@@ -102,9 +221,10 @@ func ExecutesCommand(hosts []*types.Host, commandGen CommandGenerator, handler C
 	for _, h := range hosts {
 		go func(h *types.Host, w *sync.WaitGroup, ch chan HostCmdResult) {
 			command := commandGen(h)
+			start := time.Now()
 			conn, err := CreateSSHClient(h)
 			if err != nil {
-				ch <- HostCmdResult{h, command, nil, err}
+				ch <- HostCmdResult{h, command, nil, err, time.Since(start)}
 				w.Done()
 				return
 			}
@@ -112,34 +232,51 @@ func ExecutesCommand(hosts []*types.Host, commandGen CommandGenerator, handler C
 
 			session, err := conn.NewSession()
 			if err != nil {
-				ch <- HostCmdResult{h, command, nil, err}
+				ch <- HostCmdResult{h, command, nil, err, time.Since(start)}
 				w.Done()
 				return
 			}
 			defer session.Close()
 
+			if h.ForwardAgent {
+				if err := ForwardAgent(conn.Client, session); err != nil {
+					ch <- HostCmdResult{h, command, nil, err, time.Since(start)}
+					w.Done()
+					return
+				}
+			}
+
 			var stdOut bytes.Buffer
 			var stdErr bytes.Buffer
 			session.Stdout = &stdOut
 			session.Stderr = &stdErr
 
 			err = session.Run(command)
+			if kerr := conn.Err(); kerr != nil {
+				err = kerr
+			}
 			ch <- HostCmdResult{
-				Host: h,
+				Host:    h,
+				Command: command,
 				Result: &types.ExecuteResult{
 					Error:  err,
 					StdOut: stdOut.String(),
 					StdErr: stdErr.String(),
 				},
-				Err: nil,
+				Err:      nil,
+				Duration: time.Since(start),
 			}
 			w.Done()
 		}(h, &waitGroup, cmdResults)
 	}
+	handled := make(chan struct{})
 	go func() {
+		defer close(handled)
 		for result := range cmdResults {
 			handler(result)
 		}
 	}()
 	waitGroup.Wait()
+	close(cmdResults)
+	<-handled
 }
@@ -0,0 +1,143 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zacscoding/myutils/types"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// commands of tunnel daemon
+const (
+	CommandStart    = "start"
+	CommandStop     = "stop"
+	CommandStatus   = "status"
+	CommandShutdown = "shutdown"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Request is a request to tunnel daemon.
+// Tunnels are resolved by a client, so the daemon doesn't need to access local db.
+type Request struct {
+	Command string        `json:"command"`
+	Tunnels []*TunnelSpec `json:"tunnels,omitempty"` // tunnels to start
+	Names   []string      `json:"names,omitempty"`   // names of tunnels to stop
+}
+
+// TunnelSpec is a tunnel with own host.
+type TunnelSpec struct {
+	Tunnel *types.Tunnel `json:"tunnel"`
+	Host   *types.Host   `json:"host"`
+}
+
+// Response is a response from tunnel daemon.
+type Response struct {
+	Errors   []string `json:"errors,omitempty"`
+	Statuses []Status `json:"statuses"`
+}
+
+// Serve listens given unix socket and handles requests with manager until shutdown.
+func Serve(socketPath string, m *Manager) error {
+	if _, err := Send(socketPath, &Request{Command: CommandStatus}); err == nil {
+		return errors.New("tunnel daemon is already running")
+	}
+	// remove a stale socket
+	_ = os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		return err
+	}
+	log.Println("tunnel daemon is listening :", socketPath)
+
+	shutdown := make(chan struct{})
+	var shutdownOnce sync.Once
+	go func() {
+		<-shutdown
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-shutdown:
+				m.StopAll()
+				log.Println("tunnel daemon is stopped")
+				return nil
+			default:
+				return err
+			}
+		}
+		go func() {
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(requestTimeout))
+
+			var req Request
+			if err := json.NewDecoder(conn).Decode(&req); err != nil {
+				_ = json.NewEncoder(conn).Encode(&Response{Errors: []string{err.Error()}})
+				return
+			}
+			res := handle(m, &req)
+			_ = json.NewEncoder(conn).Encode(res)
+			if req.Command == CommandShutdown {
+				shutdownOnce.Do(func() {
+					close(shutdown)
+				})
+			}
+		}()
+	}
+}
+
+// handle handles a request with manager.
+func handle(m *Manager, req *Request) *Response {
+	res := &Response{}
+	switch req.Command {
+	case CommandStart:
+		for _, spec := range req.Tunnels {
+			if err := m.Start(spec.Tunnel, spec.Host); err != nil {
+				res.Errors = append(res.Errors, err.Error())
+			}
+		}
+	case CommandStop:
+		for _, name := range req.Names {
+			if err := m.Stop(name); err != nil {
+				res.Errors = append(res.Errors, err.Error())
+			}
+		}
+	case CommandStatus, CommandShutdown:
+	default:
+		res.Errors = append(res.Errors, fmt.Sprintf("unknown command : %s", req.Command))
+	}
+	res.Statuses = m.Statuses()
+	return res
+}
+
+// Send sends a request to tunnel daemon listening given unix socket.
+func Send(socketPath string, req *Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var res Response
+	if err := json.NewDecoder(conn).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
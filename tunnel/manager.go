@@ -0,0 +1,234 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"github.com/zacscoding/myutils/remote"
+	"github.com/zacscoding/myutils/types"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// states of a managed tunnel
+const (
+	StateConnecting = "connecting"
+	StateConnected  = "connected"
+	StateRetrying   = "retrying"
+	StateStopped    = "stopped"
+)
+
+const (
+	DefaultMaxBackoff = time.Minute
+	minBackoff        = time.Second
+	stopTimeout       = 5 * time.Second
+)
+
+// Status is a current status of a managed tunnel.
+type Status struct {
+	Name      string    `json:"name"`
+	Host      string    `json:"host"`
+	Forwards  []string  `json:"forwards"`
+	State     string    `json:"state"`
+	Since     time.Time `json:"since"`
+	Retries   int       `json:"retries"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Manager keeps tunnels alive with keepalives of ssh clients and reconnects with backoff.
+type Manager struct {
+	MaxBackoff time.Duration
+
+	mu      sync.Mutex
+	tunnels map[string]*managedTunnel
+}
+
+// managedTunnel is a running tunnel in manager.
+type managedTunnel struct {
+	tunnel *types.Tunnel
+	host   *types.Host
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu     sync.Mutex
+	status Status
+}
+
+// NewManager returns a new manager with default backoff.
+func NewManager() *Manager {
+	return &Manager{
+		MaxBackoff: DefaultMaxBackoff,
+		tunnels:    make(map[string]*managedTunnel),
+	}
+}
+
+// Start starts to keep a given tunnel over a host alive.
+func (m *Manager) Start(t *types.Tunnel, h *types.Host) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tunnels[t.Name]; ok {
+		return fmt.Errorf("tunnel %s is already running", t.Name)
+	}
+	var forwards []string
+	for _, f := range t.Forwards {
+		forwards = append(forwards, f.String())
+	}
+	mt := &managedTunnel{
+		tunnel: t,
+		host:   h,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		status: Status{
+			Name:     t.Name,
+			Host:     h.Name,
+			Forwards: forwards,
+			State:    StateConnecting,
+			Since:    time.Now(),
+		},
+	}
+	m.tunnels[t.Name] = mt
+	go m.run(mt)
+	return nil
+}
+
+// Stop stops a tunnel with given name and waits until closed or timeout.
+func (m *Manager) Stop(name string) error {
+	m.mu.Lock()
+	mt, ok := m.tunnels[name]
+	delete(m.tunnels, name)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("tunnel %s is not running", name)
+	}
+	close(mt.stop)
+	select {
+	case <-mt.done:
+	case <-time.After(stopTimeout):
+		log.Printf("tunnel %s is not closed in %v\n", name, stopTimeout)
+	}
+	return nil
+}
+
+// StopAll stops all running tunnels.
+func (m *Manager) StopAll() {
+	for _, status := range m.Statuses() {
+		_ = m.Stop(status.Name)
+	}
+}
+
+// Statuses returns statuses of running tunnels sorted by name.
+func (m *Manager) Statuses() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, 0, len(m.tunnels))
+	for _, mt := range m.tunnels {
+		mt.mu.Lock()
+		statuses = append(statuses, mt.status)
+		mt.mu.Unlock()
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// run connects a tunnel and reconnects with exponential backoff until stopped.
+func (m *Manager) run(mt *managedTunnel) {
+	defer close(mt.done)
+	backoff := minBackoff
+
+	for {
+		mt.setState(StateConnecting, nil)
+		connectedAt := time.Now()
+		err := m.connect(mt)
+
+		select {
+		case <-mt.stop:
+			mt.setState(StateStopped, nil)
+			return
+		default:
+		}
+
+		// reset backoff if the tunnel was alive for a while
+		if time.Since(connectedAt) > m.MaxBackoff {
+			backoff = minBackoff
+		}
+		mt.setState(StateRetrying, err)
+		log.Printf("tunnel %s is disconnected. retry after %v. %v\n", mt.tunnel.Name, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-mt.stop:
+			mt.setState(StateStopped, nil)
+			return
+		}
+		backoff *= 2
+		if backoff > m.MaxBackoff {
+			backoff = m.MaxBackoff
+		}
+	}
+}
+
+// connect opens forwards of a tunnel and blocks until disconnected or stopped.
+func (m *Manager) connect(mt *managedTunnel) error {
+	// remote forwards require an own connection
+	conn, err := remote.DialSSHClient(mt.host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var listeners []net.Listener
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	for _, f := range mt.tunnel.Forwards {
+		l, err := remote.StartForward(conn.Client, f)
+		if err != nil {
+			return fmt.Errorf("failed to start forward %v. %v", f, err)
+		}
+		listeners = append(listeners, l)
+	}
+	mt.setState(StateConnected, nil)
+	log.Printf("tunnel %s is connected to %s\n", mt.tunnel.Name, mt.host.Name)
+
+	// the client closes the connection if keepalive requests are missed
+	disconnected := make(chan error, 1)
+	go func() {
+		disconnected <- conn.Wait()
+	}()
+
+	select {
+	case <-mt.stop:
+		return nil
+	case err := <-disconnected:
+		if err == nil {
+			err = errors.New("connection closed")
+		}
+		return err
+	}
+}
+
+// setState updates a state of the tunnel with a last error if exist.
+func (mt *managedTunnel) setState(state string, err error) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	if mt.status.State != state {
+		mt.status.Since = time.Now()
+	}
+	mt.status.State = state
+	if state == StateRetrying {
+		mt.status.Retries++
+	}
+	if err != nil {
+		mt.status.LastError = err.Error()
+	}
+}
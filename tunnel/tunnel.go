@@ -0,0 +1,103 @@
+// tunnel is management named tunnels from data store and keeps them alive.
+package tunnel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/zacscoding/myutils/db"
+	"github.com/zacscoding/myutils/types"
+	"log"
+)
+
+// AddTunnel save a given tunnel into local db
+func AddTunnel(db db.Store, t *types.Tunnel) error {
+	if t.Name == "" {
+		return errors.New("tunnel name must not be empty")
+	}
+	if t.Host == "" {
+		return errors.New("tunnel host must not be empty")
+	}
+	if len(t.Forwards) == 0 {
+		return errors.New("tunnel must have at least one forward")
+	}
+
+	encoded, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	err = db.Put(getTunnelKey(t.Name), encoded)
+	if err != nil {
+		return err
+	}
+	log.Println("Success to save a tunnel : ", string(encoded))
+	return nil
+}
+
+// GetTunnel returns a tunnel given name
+func GetTunnel(db db.Store, name string) (*types.Tunnel, error) {
+	val, err := db.Get(getTunnelKey(name))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find a tunnel %s. %v", name, err)
+	}
+
+	var t *types.Tunnel
+	err = json.Unmarshal(val, &t)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// GetTunnels returns list of tunnels from db
+func GetTunnels(db db.Store) ([]*types.Tunnel, error) {
+	itr := db.NewIteratorWithPrefix([]byte(types.TunnelPrefix))
+	defer itr.Release()
+	var tunnels []*types.Tunnel
+
+	for itr.Next() {
+		var t *types.Tunnel
+		if err := json.Unmarshal(itr.Value(), &t); err != nil {
+			fmt.Println("Failed to unmarshal tunnel.", err)
+			continue
+		}
+		tunnels = append(tunnels, t)
+	}
+	return tunnels, itr.Error()
+}
+
+// DeleteTunnel delete a tunnel with given name.
+func DeleteTunnel(db db.Store, name string) error {
+	return db.Delete(getTunnelKey(name))
+}
+
+// RenameHost adds changes of tunnels over a host renamed from oldName to newName into the batch.
+// Returns updated tunnels.
+func RenameHost(db db.Reader, batch db.Batch, oldName, newName string) ([]*types.Tunnel, error) {
+	itr := db.NewIteratorWithPrefix([]byte(types.TunnelPrefix))
+	defer itr.Release()
+
+	var updated []*types.Tunnel
+	for itr.Next() {
+		var t *types.Tunnel
+		if err := json.Unmarshal(itr.Value(), &t); err != nil {
+			return nil, fmt.Errorf("invalid tunnel %s. %v", string(itr.Key()), err)
+		}
+		if t.Host != oldName {
+			continue
+		}
+		t.Host = newName
+		encoded, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		batch.Put(getTunnelKey(t.Name), encoded)
+		updated = append(updated, t)
+	}
+	return updated, itr.Error()
+}
+
+// getTunnelKey returns a key given tunnel name with prefix("tunnel.")
+func getTunnelKey(name string) []byte {
+	return []byte(types.TunnelPrefix + name)
+}
@@ -0,0 +1,25 @@
+// audit
+package types
+
+import "time"
+
+var AuditPrefix = "audit."
+
+// Audit is a record of a remote command executed by myutils.
+type Audit struct {
+	ID       string         `json:"id"`
+	Time     time.Time      `json:"time"`
+	User     string         `json:"user"`
+	Action   string         `json:"action"` // i.e "ssh command", "scp"
+	Command  string         `json:"command"`
+	Hosts    []*AuditResult `json:"hosts"`
+	Duration time.Duration  `json:"duration"`
+}
+
+// AuditResult is a result of a host in an audit record.
+type AuditResult struct {
+	Host       string        `json:"host"`
+	ExitStatus int           `json:"exitStatus"` // -1 if the command didn't exit i.e connection failure
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
@@ -0,0 +1,30 @@
+// forward
+package types
+
+import "fmt"
+
+const (
+	ForwardLocal   = "local"
+	ForwardRemote  = "remote"
+	ForwardDynamic = "dynamic"
+)
+
+// Forward is a port forwarding over ssh.
+type Forward struct {
+	Type   string `json:"type"`             // one of local, remote and dynamic
+	Listen string `json:"listen"`           // address to listen i.e localhost:8080
+	Target string `json:"target,omitempty"` // address to connect i.e db.internal:5432. empty if dynamic
+}
+
+// String returns a forward with ssh option format i.e -L localhost:8080:db.internal:5432
+func (f *Forward) String() string {
+	switch f.Type {
+	case ForwardLocal:
+		return fmt.Sprintf("-L %s:%s", f.Listen, f.Target)
+	case ForwardRemote:
+		return fmt.Sprintf("-R %s:%s", f.Listen, f.Target)
+	case ForwardDynamic:
+		return fmt.Sprintf("-D %s", f.Listen)
+	}
+	return fmt.Sprintf("%s %s %s", f.Type, f.Listen, f.Target)
+}
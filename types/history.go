@@ -0,0 +1,31 @@
+// history
+package types
+
+import "time"
+
+var HistoryPrefix = "history."
+
+// actions of host history
+const (
+	HistoryAdd    = "add"
+	HistoryUpdate = "update"
+	HistoryDelete = "delete"
+	HistoryImport = "import"
+	HistoryTag    = "tag"
+	HistoryRevert = "revert"
+	HistoryRename = "rename"
+	HistoryClone  = "clone"
+)
+
+// History is a version of a host record changed by an action.
+// Before is nil if the host is added and After is nil if the host is deleted.
+type History struct {
+	Version int       `json:"version"`
+	Name    string    `json:"name"`
+	Action  string    `json:"action"`
+	User    string    `json:"user"`
+	Time    time.Time `json:"time"`
+	Before  *Host     `json:"before,omitempty"`
+	After   *Host     `json:"after,omitempty"`
+	Diff    []string  `json:"diff,omitempty"`
+}
@@ -4,13 +4,21 @@ package types
 var HostPrefix = "host."
 
 type Host struct {
-	Name        string `json:"name"`
-	User        string `json:"user"`
-	Address     string `json:"address"`
-	Port        int    `json:"port"`
-	Password    string `json:"password"`
-	KeyPath     string `json:"keypath"`
-	Description string `json:"description"`
+	Name        string     `json:"name"`
+	User        string     `json:"user"`
+	Address     string     `json:"address"`
+	Port        int        `json:"port"`
+	Password    string     `json:"password"`
+	KeyPath     string     `json:"keypath"`
+	Description string     `json:"description"`
+	Tags        []string   `json:"tags,omitempty"`
+	Forwards    []*Forward `json:"forwards,omitempty"`
+	// ForwardAgent is true if the host is trusted to forward local ssh agent
+	ForwardAgent bool `json:"forwardAgent,omitempty"`
+	// KeepAlive is an interval seconds of keepalive requests. 0 is default(30) and negative disables it
+	KeepAlive int `json:"keepAlive,omitempty"`
+	// KeepAliveMaxMissed is a number of missed keepalive replies to close the connection. 0 is default(3)
+	KeepAliveMaxMissed int `json:"keepAliveMaxMissed,omitempty"`
 }
 
 // Check has password or pem path.
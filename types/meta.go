@@ -0,0 +1,7 @@
+// meta
+package types
+
+var MetaPrefix = "meta."
+
+// SchemaVersionKey is a key of schema version of stored records
+var SchemaVersionKey = MetaPrefix + "schema.version"
@@ -0,0 +1,11 @@
+// tunnel
+package types
+
+var TunnelPrefix = "tunnel."
+
+// Tunnel is a named set of forwards over a host kept alive by tunnel daemon.
+type Tunnel struct {
+	Name     string     `json:"name"`
+	Host     string     `json:"host"`
+	Forwards []*Forward `json:"forwards"`
+}
@@ -3,8 +3,11 @@ package utils
 
 import (
 	"github.com/urfave/cli"
+	"github.com/zacscoding/myutils/db"
+	"os"
 	"os/user"
 	"path/filepath"
+	"time"
 )
 
 var (
@@ -41,6 +44,169 @@ var (
 		Name:  "description, d",
 		Usage: "description of host.",
 	}
+	HostTagFlag = cli.StringSliceFlag{
+		Name:  "tag, t",
+		Usage: "tag of the host. can be repeated.",
+	}
+	QueryNameFlag = cli.StringSliceFlag{
+		Name:  "name, n",
+		Usage: "glob pattern of host names i.e web-*. can be repeated.",
+	}
+	QueryAddressFlag = cli.StringFlag{
+		Name:  "address, a",
+		Usage: "CIDR or ip of host addresses i.e 10.0.0.0/24.",
+	}
+	QueryUserFlag = cli.StringFlag{
+		Name:  "user, u",
+		Usage: "username of hosts.",
+	}
+	QueryTagFlag = cli.StringSliceFlag{
+		Name:  "tag, t",
+		Usage: "tag which hosts must have. can be repeated.",
+	}
+	QueryTextFlag = cli.StringFlag{
+		Name:  "text",
+		Usage: "case-insensitive text in description of hosts.",
+	}
+	QuerySortFlag = cli.StringFlag{
+		Name:  "sort",
+		Usage: "sort by name, address, user or port. prefix \"-\" sorts in descending order.",
+		Value: "name",
+	}
+	QueryLimitFlag = cli.IntFlag{
+		Name:  "limit",
+		Usage: "max number of hosts. 0 is unlimited.",
+	}
+	QueryOffsetFlag = cli.IntFlag{
+		Name:  "offset",
+		Usage: "number of hosts to skip.",
+	}
+	UnsetFieldFlag = cli.StringSliceFlag{
+		Name:  "unset",
+		Usage: "clear an optional field i.e password, keypath, description, tags, forwards, forward-agent, keepalive or keepalive-max-missed. can be repeated.",
+	}
+	AddTagFlag = cli.StringSliceFlag{
+		Name:  "add",
+		Usage: "tag to add. can be repeated.",
+	}
+	RemoveTagFlag = cli.StringSliceFlag{
+		Name:  "remove",
+		Usage: "tag to remove. can be repeated.",
+	}
+	RevertVersionFlag = cli.IntFlag{
+		Name:  "to",
+		Usage: "version of host history to revert to. default reverts the latest change.",
+	}
+	HostForwardAgentFlag = cli.BoolFlag{
+		Name:  "forward-agent",
+		Usage: "trust the host to forward local ssh agent.",
+	}
+	HostKeepAliveFlag = cli.IntFlag{
+		Name:  "keepalive",
+		Usage: "interval seconds of keepalive requests. 0 is default(30) and negative disables it.",
+	}
+	HostKeepAliveMaxMissedFlag = cli.IntFlag{
+		Name:  "keepalive-max-missed",
+		Usage: "number of missed keepalive replies to close the connection. 0 is default(3).",
+	}
+	ForwardAgentFlag = cli.BoolFlag{
+		Name:  "forward-agent, A",
+		Usage: "forward local ssh agent(SSH_AUTH_SOCK) to remote hosts.",
+	}
+	EscapeCharFlag = cli.StringFlag{
+		Name:  "escape-char, e",
+		Usage: "escape character of the shell with a pty or \"none\" to disable escapes.",
+		Value: "~",
+	}
+	ScpDirectFlag = cli.BoolFlag{
+		Name:  "direct",
+		Usage: "copy between hosts with a direct connection from source host to destination host.",
+	}
+	ScpPreserveFlag = cli.BoolFlag{
+		Name:  "preserve",
+		Usage: "preserve modes, access/modification times and ownership of sources. (default between two hosts, --preserve=false to disable)",
+	}
+	ScpIncludeFlag = cli.StringSliceFlag{
+		Name:  "include",
+		Usage: "glob pattern of files to copy. (can be repeated)",
+	}
+	ScpExcludeFlag = cli.StringSliceFlag{
+		Name:  "exclude",
+		Usage: "glob pattern of files or directories to skip. (can be repeated)",
+	}
+	ScpChecksumFlag = cli.BoolFlag{
+		Name:  "checksum",
+		Usage: "verify SHA-256 checksum of each file after transfer.",
+	}
+	RecordFlag = cli.BoolFlag{
+		Name:  "record",
+		Usage: "record the shell session as asciicast in workspace.",
+	}
+	PlaySpeedFlag = cli.Float64Flag{
+		Name:  "speed",
+		Usage: "playback speed multiplier.",
+		Value: 1,
+	}
+	PlayMaxIdleFlag = cli.DurationFlag{
+		Name:  "max-idle",
+		Usage: "limit idle time between outputs while playing. (0 is unlimited)",
+		Value: 2 * time.Second,
+	}
+	LocalForwardFlag = cli.StringSliceFlag{
+		Name:  "L",
+		Usage: "local forward [bind_address:]port:host:hostport. (can be repeated)",
+	}
+	RemoteForwardFlag = cli.StringSliceFlag{
+		Name:  "R",
+		Usage: "remote forward [bind_address:]port:host:hostport. (can be repeated)",
+	}
+	DynamicForwardFlag = cli.StringSliceFlag{
+		Name:  "D",
+		Usage: "dynamic forward as SOCKS5 proxy [bind_address:]port. (can be repeated)",
+	}
+	SaveForwardsFlag = cli.BoolFlag{
+		Name:  "save",
+		Usage: "save given forwards to the host.",
+	}
+	MuxIdleTimeoutFlag = cli.DurationFlag{
+		Name:  "idle",
+		Usage: "close connections without sessions after given idle time.",
+		Value: 10 * time.Minute,
+	}
+	DBTimeoutFlag = cli.DurationFlag{
+		Name:  "db-timeout",
+		Usage: "max duration to wait for the local store used by another myutils process.",
+		Value: 5 * time.Second,
+	}
+	BackupPathFlag = cli.StringFlag{
+		Name:  "path",
+		Usage: "path of backup archive. default is a new file in workspace/backups.",
+	}
+	AuditHostFlag = cli.StringFlag{
+		Name:  "host",
+		Usage: "name of a host in audit records.",
+	}
+	AuditSinceFlag = cli.StringFlag{
+		Name:  "since",
+		Usage: "start time i.e 2006-01-02, \"2006-01-02 15:04\", RFC3339 or a duration before now like 24h.",
+	}
+	AuditUntilFlag = cli.StringFlag{
+		Name:  "until",
+		Usage: "end time i.e 2006-01-02, \"2006-01-02 15:04\", RFC3339 or a duration before now like 1h.",
+	}
+	AuditLimitFlag = cli.IntFlag{
+		Name:  "limit",
+		Usage: "max number of latest records. 0 is unlimited.",
+	}
+	DryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "show changes without writing them.",
+	}
+	ExportFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "export format [cast | text].",
+		Value: "cast",
+	}
 )
 
 func NewApp() *cli.App {
@@ -52,15 +218,81 @@ func NewApp() *cli.App {
 	return app
 }
 
-// GetDatabasePath returns a db directory i.e workspace/myutilsdb
-func GetDatabasePath() (string, error) {
+// GetDatabaseBackend returns a backend of local store from MYUTILS_DB_BACKEND env i.e leveldb(default), json, memory
+func GetDatabaseBackend() string {
+	if backend := os.Getenv("MYUTILS_DB_BACKEND"); backend != "" {
+		return backend
+	}
+	return db.BackendLevelDB
+}
+
+// GetDatabasePath returns a db path given backend
+// i.e workspace/myutilsdb directory for leveldb and workspace/myutilsdb.json for json
+func GetDatabasePath(backend string) (string, error) {
 	workspace, err := GetWorkspace()
 	if err != nil {
 		return "", err
 	}
+	if backend == db.BackendJSON {
+		return filepath.Join(workspace, "myutilsdb.json"), nil
+	}
 	return filepath.Join(workspace, "myutilsdb"), nil
 }
 
+// GetBackupsPath returns a directory of store backups i.e workspace/backups
+func GetBackupsPath() (string, error) {
+	workspace, err := GetWorkspace()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(workspace, "backups"), nil
+}
+
+// GetSessionsPath returns a directory of recorded sessions i.e workspace/sessions
+func GetSessionsPath() (string, error) {
+	workspace, err := GetWorkspace()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(workspace, "sessions"), nil
+}
+
+// GetTunnelSocketPath returns a unix socket path of tunnel daemon i.e workspace/tunnel.sock
+func GetTunnelSocketPath() (string, error) {
+	workspace, err := GetWorkspace()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(workspace, "tunnel.sock"), nil
+}
+
+// GetTunnelLogPath returns a log file path of tunnel daemon i.e workspace/tunnel.log
+func GetTunnelLogPath() (string, error) {
+	workspace, err := GetWorkspace()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(workspace, "tunnel.log"), nil
+}
+
+// GetMuxSocketPath returns a unix socket path of multiplexing daemon i.e workspace/mux.sock
+func GetMuxSocketPath() (string, error) {
+	workspace, err := GetWorkspace()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(workspace, "mux.sock"), nil
+}
+
+// GetMuxLogPath returns a log file path of multiplexing daemon i.e workspace/mux.log
+func GetMuxLogPath() (string, error) {
+	workspace, err := GetWorkspace()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(workspace, "mux.log"), nil
+}
+
 // GetWorkspace returns myutils workspace i.e ~/myutils
 func GetWorkspace() (string, error) {
 	cu, err := user.Current()
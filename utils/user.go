@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"os"
+	"os/user"
+)
+
+// CurrentUser returns user@hostname of this process.
+func CurrentUser() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		name += "@" + hostname
+	}
+	return name
+}